@@ -1,8 +1,189 @@
-
 WorkloadAttestor "user" {
   plugin_cmd = "path_to_plugin_cmd"
   plugin_data {
-    user_attestation_service_url = ""
-    user_attestation_module_path = ""
+    # Auth service endpoint, required when the validator chain below has an
+    # "auth_service" step. Without an endpoint and a chain, attestations are
+    # not validated. The plugin POSTs every attestation as JSON:
+    #   {"token": "...", "user_info": {"name": "...", "secret": "...",
+    #    "system_info": {"user_id": "1001", "username": "alice",
+    #     "group_id": "1001", "group_name": "alice",
+    #     "supplementary_groups": [{"group_id": "27", "group_name": "sudo"}]}}}
+    # and expects {"is_valid": true, "message": "...", "expires_at": 1767225600}
+    # back, expires_at being an optional unix time. A 2xx answer, or a 4xx one
+    # with is_valid false, is the decision of the service; other answers,
+    # timeouts and undecodable bodies count as endpoint failures and the next
+    # endpoint is tried.
+    user_attestation_service_url = "http://127.0.0.1:8080/validate"
+    user_attestation_module_path = "/run/user-attestor/module.sock"
+
+    # Several modules can report the user instead of user_attestation_module_path.
+    # They are queried in parallel and combined by modules_mode:
+    # "first_success" uses the first module, in this order, that answers, as
+    # soon as it answered and the modules before it failed, without waiting
+    # for the later ones; "all_required" needs all of them; "merge" combines
+    # those that answer. Modules reporting different users fail the
+    # attestation in "all_required" and "merge".
+    # modules_mode = "first_success"
+    # module "laptop" {
+    #   transport       = "unix" # or "tcp" for a loopback host:port
+    #   address         = "/run/user-attestor/laptop.sock"
+    #   selector_prefix = "laptop"
+    #   min_version     = "1.2.0"
+    # }
+
+    # Oldest module version accepted, checked when the plugin negotiates the
+    # protocol and features with each module. Modules without capabilities
+    # support are accepted as protocol version 1 unless this is set.
+    # module_min_version = "1.0.0"
+
+    # Additional auth service endpoints, tried after user_attestation_service_url
+    # in the listed order when auth_service_load_balancing is "failover".
+    # user_attestation_service_urls = ["https://zone-a.example", "https://zone-b.example"]
+    # auth_service_load_balancing = "failover" # or "round_robin", "least_latency"
+    # auth_service_timeout = "5s"
+
+    # Endpoints failing this many times in a row are ejected for the given time.
+    # auth_service_outlier_consecutive_failures = 3
+    # auth_service_outlier_ejection_time = "30s"
+
+    # Ordered validation chain with PAM-like modes: "required", "requisite"
+    # (a failure ends the chain at once), "sufficient" or "optional". Defaults
+    # to the auth service alone as a required step when an endpoint is set.
+    # validator "local_account" { mode = "required" }
+    # validator "auth_service" { mode = "required" }
+
+    # CEL policy files compiled at configure time, see examples/policy. Test
+    # them with: user_wl_attestor policy-test -policy <file> <test file>
+    # policy_files = ["/etc/spire/user-attestor/policy.hcl"]
+
+    # Where the host procfs and the passwd/group files are mounted when the
+    # agent runs in a container, e.g. "/host/proc" and "/host/etc".
+    # proc_root = "/proc"
+    # etc_root = "/etc"
+
+    # Cross-checks the user and groups reported by the module with the passwd
+    # and group files under etc_root. "drop" removes supplementary groups the
+    # user is not a member of, "reject" fails the attestation instead.
+    # group_verification = "off"
+
+    # Compares the supplementary groups reported by the module with the
+    # Groups line of <proc_root>/<pid>/status: "intersect" keeps only the groups the
+    # process has, "reject" fails the attestation on any difference.
+    # process_groups_check = "off"
+
+    # Verifies the OpenSSH user certificate returned by the module against
+    # these CAs and adds ssh:principal, ssh:key_id and ssh:extension selectors.
+    # ssh_ca_keys = ["ssh-ed25519 AAAA... user-ca"]
+    # ssh_ca_keys_file = "/etc/ssh/user_ca.pub"
+    # require_ssh_certificate = false
+    # ssh_principal_match = false
+
+    # For processes in user namespaces, translates the IDs reported by the
+    # module through /proc/<pid>/uid_map and gid_map: "host" when the module
+    # reports host IDs, "process" when it reports the IDs seen by the process.
+    # Host IDs are used for every check and system:* selector, the IDs inside
+    # the namespace are added as system:inner_* selectors.
+    # user_namespace_ids = "off"
+
+    # Adds container:id, container:runtime, cgroup:path, ns:pid and ns:user
+    # selectors. require_host_namespaces refuses processes outside the pid and
+    # user namespaces of the host init process.
+    # container_selectors = false
+    # require_host_namespaces = false
+
+    # Adds login:uid, login:username and login:session_id selectors from the
+    # audit login session of the process, which is kept across sudo and su.
+    # require_login_user_match rejects processes whose login user is not the
+    # user reported by the module.
+    # login_selectors = false
+    # require_login_user_match = false
+
+    # Adds ldap:group:<name> and ldap:attr:<attribute>:<value> selectors for
+    # the user reported by the module.
+    # ldap {
+    #   url = "ldaps://ldap.example.com"
+    #   bind_dn = "cn=spire,ou=services,dc=example,dc=com"
+    #   bind_password = ""
+    #   base_dn = "ou=people,dc=example,dc=com"
+    #   user_filter = "(uid=%s)"
+    #   group_attribute = "memberOf"
+    #   attributes = ["department"]
+    #   start_tls = false
+    #   ca_file = ""
+    #   timeout = "5s"
+    #   cache_ttl = "5m"
+    #   required = false
+    # }
+
+    # Validates the module token as an OIDC ID token when the "oidc" validator
+    # is part of the chain. With require_nonce the nonce claim must be the
+    # unpadded base64url encoding of the nonce sent to the module.
+    # oidc {
+    #   issuer = "https://idp.example.com"
+    #   audience = "spire-user-attestor"
+    #   require_nonce = false
+    #   user_claim = "email"
+    #   claim_selectors = { email = "email", groups = "group", sub = "sub" }
+    #   timeout = "5s"
+    #   discovery_cache_ttl = "1h"
+    # }
+
+    # Circuit breaker around the auth service.
+    # auth_service_failure_threshold = 5
+    # auth_service_reset_timeout = "30s"
+
+    # Reuse a recent successful validation while the auth service is down.
+    # Validations older than the grace period are dropped, and at most 10000,
+    # one per user and token, are kept.
+    # allow_degraded_validation = false
+    # auth_service_grace_period = "5m"
+
+    # Revoked tokens, as {"token_sha256": [...], "jti": [...]}, read from a file
+    # or fetched with ETag support, e.g. from the auth service. Tokens are
+    # checked before validation. Attestations fail until the list was loaded
+    # once and, with a max age, once it could not be refreshed for that long.
+    # revocation_list_file = "/etc/spire/user-attestor/revoked.json"
+    # revocation_list_url = "https://auth.example/revocations"
+    # revocation_list_refresh_interval = "1m"
+    # revocation_list_max_age = "15m"
+
+    # Rejects tokens expiring within this margin when the module or a validator
+    # reports the expiry, which also adds a token:expires_bucket selector
+    # (lt_15m, lt_1h, lt_8h, lt_24h or ge_24h) and caps the degraded validation
+    # grace period to the token lifetime.
+    # token_expiry_margin = "5m"
+
+    # Serves the plugin metrics, such as the revocation list size and age, as
+    # JSON on http://<address>/debug/vars. An address without a host, such as
+    # ":9464", listens on loopback only.
+    # metrics_address = "127.0.0.1:9464"
+
+    # Logs every module response and auth service exchange at debug level.
+    # Tokens, secrets, signatures and authorization headers are replaced by a
+    # short hash, which still tells whether two lines are about the same token.
+    # log_exchanges = false
+
+    # "enforce" (default) fails attestations that a check denies. "shadow"
+    # runs every check but only logs, with "audit" = true, what would have been
+    # denied, and returns the selectors the attestation gets without the
+    # failed checks, e.g. to roll out the auth service or new policies. Would-be
+    # denials are counted in the shadow_denied_attestations and shadow_denials
+    # metrics. Failures to get the user from the modules are always enforced.
+    # enforcement = "enforce"
+
+    # Attests processes running as service accounts without the user module
+    # and the auth service. A process qualifies when its real and effective
+    # UIDs are both in uid_ranges or users and, when gid_ranges is set, its
+    # real and effective GIDs are both in gid_ranges as well, and it does not
+    # belong to a login session, such as a command run with sudo. It gets
+    # mode:service_account, its system:* selectors read from procfs and the
+    # passwd and group files under etc_root, and process:name and process:exe.
+    # The revocation list must be available and policies still apply, with
+    # the account as the user.
+    # service_accounts {
+    #   uid_ranges = ["0-999", "65534"]
+    #   gid_ranges = []
+    #   users      = ["postgres", "www-data"]
+    # }
   }
 }
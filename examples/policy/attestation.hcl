@@ -0,0 +1,23 @@
+rule "deny-system-users" {
+  condition = "user.uid != '' && int(user.uid) < 1000"
+  effect    = "deny"
+  message   = "system users cannot be attested as humans"
+}
+
+rule "contractors-approved-binaries" {
+  condition = "'contractors' in user.groups && !process.exe.startsWith('/opt/approved/')"
+  effect    = "deny"
+  message   = "contractors may only attest binaries under /opt/approved"
+}
+
+rule "drop-secret" {
+  condition = "true"
+  effect    = "remove_selectors"
+  selectors = ["secret:*"]
+}
+
+rule "tag-degraded" {
+  condition = "validation.degraded"
+  effect    = "add_selectors"
+  selectors = ["policy:degraded"]
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"wl/plugin"
 
 	"github.com/spiffe/spire-plugin-sdk/pluginmain"
@@ -9,6 +10,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "policy-test" {
+		os.Exit(runPolicyTests(os.Args[2:]))
+	}
+
 	plugin := new(plugin.Plugin)
 	pluginmain.Serve(
 		workloadattestorv1.WorkloadAttestorPluginServer(plugin),
@@ -0,0 +1,33 @@
+package plugin
+
+import (
+	"errors"
+	"wl/plugin/domain"
+	adAdptr "wl/plugin/infrastructure/accountDatabase"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (p *Plugin) verifyAccount(config *Config, attestationData *domain.UserAttestation) (*domain.UserAttestation, error) {
+	verifier := adAdptr.AccountVerifier{Database: adAdptr.AccountDatabase{EtcDir: config.EtcRoot}}
+
+	verified, dropped, err := verifier.Verify(attestationData)
+	switch {
+	case errors.Is(err, adAdptr.ErrAccountMismatch):
+		p.logger.Error("Module reported an account that does not match the account database", "error", err)
+		return nil, status.Errorf(codes.PermissionDenied, "account verification failed: %v", err)
+	case err != nil:
+		p.logger.Error("Failed to read the account database", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read the account database: %v", err)
+	}
+
+	if len(dropped) > 0 {
+		if config.GroupVerification == groupVerificationReject {
+			p.logger.Error("Module reported groups the user is not a member of", "user", verified.UserInfo.SystemInfo.Username, "groups", dropped)
+			return nil, status.Errorf(codes.PermissionDenied, "account verification failed: %v", dropped)
+		}
+		p.logger.Warn("Dropping groups the user is not a member of", "user", verified.UserInfo.SystemInfo.Username, "groups", dropped)
+	}
+	return verified, nil
+}
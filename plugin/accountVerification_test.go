@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"slices"
+	"testing"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestVerifyAccountFillsInNames(t *testing.T) {
+	p, config := newInspectionTest(t, `group_verification = "reject"`)
+
+	attestation := &domain.UserAttestation{UserInfo: domain.UserInfo{
+		Name: "alice",
+		SystemInfo: domain.SystemInfo{
+			UserID:              "1001",
+			SupplementaryGroups: []domain.GroupInfo{{GroupID: "27"}},
+		},
+	}}
+	verified, err := p.verifyAccount(config, attestation)
+	if err != nil {
+		t.Fatalf("verifyAccount failed: %v", err)
+	}
+	expected := newAliceAttestation(domain.GroupInfo{GroupID: "27", GroupName: "sudo"}).UserInfo.SystemInfo
+	systemInfo := verified.UserInfo.SystemInfo
+	if systemInfo.Username != expected.Username || systemInfo.GroupID != expected.GroupID || systemInfo.GroupName != expected.GroupName ||
+		!slices.Equal(systemInfo.SupplementaryGroups, expected.SupplementaryGroups) {
+		t.Errorf("expected %+v, got %+v", expected, systemInfo)
+	}
+}
+
+func TestVerifyAccountForeignGroups(t *testing.T) {
+	attestation := newAliceAttestation(domain.GroupInfo{GroupID: "27"}, domain.GroupInfo{GroupID: "1500"})
+
+	p, config := newInspectionTest(t, `group_verification = "drop"`)
+	verified, err := p.verifyAccount(config, attestation)
+	if err != nil {
+		t.Fatalf("verifyAccount failed: %v", err)
+	}
+	if groups := verified.UserInfo.SystemInfo.SupplementaryGroups; !slices.Equal(groups, []domain.GroupInfo{{GroupID: "27", GroupName: "sudo"}}) {
+		t.Errorf("expected contractors to be dropped, got %v", groups)
+	}
+
+	p, config = newInspectionTest(t, `group_verification = "reject"`)
+	_, err = p.verifyAccount(config, attestation)
+	requireCode(t, err, codes.PermissionDenied)
+}
+
+func TestVerifyAccountErrors(t *testing.T) {
+	p, config := newInspectionTest(t, `group_verification = "drop"`)
+
+	root := newAliceAttestation()
+	root.UserInfo.SystemInfo.UserID = "0"
+	_, err := p.verifyAccount(config, root)
+	requireCode(t, err, codes.PermissionDenied)
+
+	config.EtcRoot = "testdata/missing"
+	_, err = p.verifyAccount(config, newAliceAttestation())
+	requireCode(t, err, codes.Internal)
+}
@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validateAttestation rejects module data that breaks the invariants of a
+// user before it is sent to the auth service. Duplicate groups mean the
+// module contradicts itself about the user, anything else is malformed data.
+func (p *Plugin) validateAttestation(pid int32, attestationData *domain.UserAttestation) error {
+	err := attestationData.Validate()
+	if err == nil {
+		return nil
+	}
+	// Joined errors are one per line, which would split the log line.
+	reason := strings.ReplaceAll(err.Error(), "\n", "; ")
+
+	var duplicateErr *domain.DuplicateGroupError
+	if errors.As(err, &duplicateErr) {
+		p.logger.Warn("Module reported inconsistent attestation data", "audit", true, "pid", pid, "user", attestationData.UserInfo.Name, "reason", reason)
+		return status.Errorf(codes.PermissionDenied, "inconsistent attestation data: %s", reason)
+	}
+	p.logger.Error("Module reported invalid attestation data", "pid", pid, "user", attestationData.UserInfo.Name, "reason", reason)
+	return status.Errorf(codes.InvalidArgument, "invalid attestation data: %s", reason)
+}
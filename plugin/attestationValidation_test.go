@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestValidateAttestationCodes(t *testing.T) {
+	p, _ := newInspectionTest(t, "")
+	for _, tc := range []struct {
+		name   string
+		change func(attestation *domain.UserAttestation)
+		code   codes.Code
+	}{
+		{name: "valid", change: func(*domain.UserAttestation) {}, code: codes.OK},
+		{name: "user id only", change: func(a *domain.UserAttestation) { a.UserInfo.SystemInfo.Username = "" }, code: codes.OK},
+		{name: "username only", change: func(a *domain.UserAttestation) { a.UserInfo.SystemInfo.UserID = "" }, code: codes.OK},
+		{name: "missing field", change: func(a *domain.UserAttestation) { a.UserInfo.Name = "" }, code: codes.InvalidArgument},
+		{name: "invalid id", change: func(a *domain.UserAttestation) { a.UserInfo.SystemInfo.UserID = "alice" }, code: codes.InvalidArgument},
+		{name: "oversized value", change: func(a *domain.UserAttestation) { a.UserInfo.Name = strings.Repeat("a", domain.MaxValueLength+1) }, code: codes.InvalidArgument},
+		{
+			name: "duplicate group",
+			change: func(a *domain.UserAttestation) {
+				a.UserInfo.SystemInfo.SupplementaryGroups = []domain.GroupInfo{{GroupID: "27"}, {GroupID: "27", GroupName: "sudo"}}
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "duplicate group and invalid id",
+			change: func(a *domain.UserAttestation) {
+				a.UserInfo.SystemInfo.GroupID = "staff"
+				a.UserInfo.SystemInfo.SupplementaryGroups = []domain.GroupInfo{{GroupID: "27"}, {GroupID: "27"}}
+			},
+			code: codes.PermissionDenied,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attestation := newAliceAttestation()
+			tc.change(attestation)
+			requireCode(t, p.validateAttestation(hostPid, attestation), tc.code)
+		})
+	}
+}
+
+// TestValidatedAttestationIsFilledIn checks a module reporting the user ID
+// alone passes validation and gets its username from account verification.
+func TestValidatedAttestationIsFilledIn(t *testing.T) {
+	p, config := newInspectionTest(t, `group_verification = "drop"`)
+	attestation := &domain.UserAttestation{UserInfo: domain.UserInfo{Name: "alice", SystemInfo: domain.SystemInfo{UserID: "1001"}}}
+
+	if err := p.validateAttestation(hostPid, attestation); err != nil {
+		t.Fatalf("validateAttestation failed: %v", err)
+	}
+	verified, err := p.verifyAccount(config, attestation)
+	if err != nil {
+		t.Fatalf("verifyAccount failed: %v", err)
+	}
+	if verified.UserInfo.SystemInfo.Username != "alice" {
+		t.Errorf("expected the username to be filled in, got %+v", verified.UserInfo.SystemInfo)
+	}
+}
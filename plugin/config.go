@@ -1,14 +1,236 @@
 package plugin
 
 import (
+	"os"
+	"strings"
+	"time"
+	scAdptr "wl/plugin/infrastructure/sshCertificate"
+	uamAdptr "wl/plugin/infrastructure/userAttestationModule"
+
 	"github.com/hashicorp/hcl"
+	"golang.org/x/crypto/ssh"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	defaultAuthServiceFailureThreshold = 5
+	defaultAuthServiceResetTimeout     = 30 * time.Second
+	defaultAuthServiceGracePeriod      = 5 * time.Minute
+	defaultAuthServiceTimeout          = 5 * time.Second
+	defaultAuthServiceLoadBalancing    = "failover"
+	defaultAuthServiceOutlierFailures  = 3
+	defaultAuthServiceEjectionTime     = 30 * time.Second
+	defaultLDAPUserFilter              = "(uid=%s)"
+	defaultLDAPGroupAttribute          = "memberOf"
+	defaultLDAPTimeout                 = 5 * time.Second
+	defaultLDAPCacheTTL                = 5 * time.Minute
+	defaultProcRoot                    = "/proc"
+	defaultEtcRoot                     = "/etc"
+	defaultOIDCTimeout                 = 5 * time.Second
+	defaultOIDCDiscoveryCacheTTL       = time.Hour
+	defaultRevocationRefreshInterval   = time.Minute
+)
+
+const (
+	userNamespaceIDsOff     = "off"
+	userNamespaceIDsHost    = "host"
+	userNamespaceIDsProcess = "process"
+)
+
+const (
+	processGroupsCheckOff       = "off"
+	processGroupsCheckIntersect = "intersect"
+	processGroupsCheckReject    = "reject"
+)
+
+const (
+	groupVerificationOff    = "off"
+	groupVerificationDrop   = "drop"
+	groupVerificationReject = "reject"
+)
+
+const (
+	defaultModuleName = "default"
+
+	modulesModeFirstSuccess = "first_success"
+	modulesModeAllRequired  = "all_required"
+	modulesModeMerge        = "merge"
+)
+
+const (
+	validatorAuthService  = "auth_service"
+	validatorLocalAccount = "local_account"
+	validatorOIDC         = "oidc"
+)
+
+type OIDCConfig struct {
+	Issuer            string            `hcl:"issuer"`
+	Audience          string            `hcl:"audience"`
+	RequireNonce      bool              `hcl:"require_nonce"`
+	UserClaim         string            `hcl:"user_claim"`
+	ClaimSelectors    map[string]string `hcl:"claim_selectors"`
+	Timeout           string            `hcl:"timeout"`
+	DiscoveryCacheTTL string            `hcl:"discovery_cache_ttl"`
+
+	timeout           time.Duration
+	discoveryCacheTTL time.Duration
+}
+
+type LDAPConfig struct {
+	URL                string   `hcl:"url"`
+	BindDN             string   `hcl:"bind_dn"`
+	BindPassword       string   `hcl:"bind_password"`
+	BaseDN             string   `hcl:"base_dn"`
+	UserFilter         string   `hcl:"user_filter"`
+	GroupAttribute     string   `hcl:"group_attribute"`
+	Attributes         []string `hcl:"attributes"`
+	StartTLS           bool     `hcl:"start_tls"`
+	CAFile             string   `hcl:"ca_file"`
+	InsecureSkipVerify bool     `hcl:"insecure_skip_verify"`
+	Timeout            string   `hcl:"timeout"`
+	CacheTTL           string   `hcl:"cache_ttl"`
+	// Required fails the attestation when the directory cannot be reached
+	// instead of attesting without the LDAP selectors.
+	Required bool `hcl:"required"`
+
+	timeout  time.Duration
+	cacheTTL time.Duration
+}
+
+type ModuleConfig struct {
+	Name      string `hcl:",key"`
+	Transport string `hcl:"transport"`
+	Address   string `hcl:"address"`
+	// SelectorPrefix, when set, adds <prefix>:name and <prefix>:username
+	// selectors for the user this module reported.
+	SelectorPrefix string `hcl:"selector_prefix"`
+	MinVersion     string `hcl:"min_version"`
+}
+
+// ServiceAccountsConfig selects the processes attested as service accounts,
+// without a user module or auth service.
+type ServiceAccountsConfig struct {
+	// UIDRanges and GIDRanges hold single IDs, "33", and inclusive ranges,
+	// "0-999". GIDRanges only narrows the users matched by UIDRanges and
+	// Users, as anyone able to switch to a group would qualify otherwise.
+	UIDRanges []string `hcl:"uid_ranges"`
+	GIDRanges []string `hcl:"gid_ranges"`
+	// Users are usernames looked up in the passwd file under etc_root.
+	Users []string `hcl:"users"`
+
+	uidRanges []idRange
+	gidRanges []idRange
+}
+
+type ValidatorConfig struct {
+	Name string `hcl:",key"`
+	Mode string `hcl:"mode"`
+}
+
 type Config struct {
-	UserAttestationServiceURL       string `hcl:"user_attestation_service_url"`
-	UserAttestationModuleSocketPath string `hcl:"user_attestation_module_path"`
+	UserAttestationServiceURL       string   `hcl:"user_attestation_service_url"`
+	UserAttestationServiceURLs      []string `hcl:"user_attestation_service_urls"`
+	UserAttestationModuleSocketPath string   `hcl:"user_attestation_module_path"`
+
+	// Modules replaces user_attestation_module_path when several modules
+	// report the user. ModulesMode decides how their answers are combined.
+	Modules     []ModuleConfig `hcl:"module"`
+	ModulesMode string         `hcl:"modules_mode"`
+	// ModuleMinVersion is the oldest module version accepted by default,
+	// modules older than that fail to attest.
+	ModuleMinVersion string `hcl:"module_min_version"`
+
+	AuthServiceTimeout             string `hcl:"auth_service_timeout"`
+	AuthServiceLoadBalancing       string `hcl:"auth_service_load_balancing"`
+	AuthServiceOutlierFailures     int    `hcl:"auth_service_outlier_consecutive_failures"`
+	AuthServiceOutlierEjectionTime string `hcl:"auth_service_outlier_ejection_time"`
+
+	AuthServiceFailureThreshold int    `hcl:"auth_service_failure_threshold"`
+	AuthServiceResetTimeout     string `hcl:"auth_service_reset_timeout"`
+	AllowDegradedValidation     bool   `hcl:"allow_degraded_validation"`
+	AuthServiceGracePeriod      string `hcl:"auth_service_grace_period"`
+
+	Validators []ValidatorConfig `hcl:"validator"`
+
+	PolicyFiles []string `hcl:"policy_files"`
+
+	LDAP *LDAPConfig `hcl:"ldap"`
+
+	OIDC *OIDCConfig `hcl:"oidc"`
+
+	// ProcRoot and EtcRoot are where the host procfs and the directory holding
+	// the passwd and group files are found, e.g. /host/proc and /host/etc when
+	// the agent runs in a container.
+	ProcRoot          string `hcl:"proc_root"`
+	EtcRoot           string `hcl:"etc_root"`
+	GroupVerification string `hcl:"group_verification"`
+
+	ProcessGroupsCheck string `hcl:"process_groups_check"`
+
+	// SSHCAKeys and SSHCAKeysFile hold the authorized_keys formatted public
+	// keys of the CAs trusted to issue user certificates.
+	SSHCAKeys             []string `hcl:"ssh_ca_keys"`
+	SSHCAKeysFile         string   `hcl:"ssh_ca_keys_file"`
+	RequireSSHCertificate bool     `hcl:"require_ssh_certificate"`
+	// SSHPrincipalMatch requires the certificate to be valid for the username
+	// reported by the module.
+	SSHPrincipalMatch bool `hcl:"ssh_principal_match"`
+
+	// UserNamespaceIDs tells in which user namespace the module reports IDs,
+	// "host" or "process", so they can be translated through the uid_map and
+	// gid_map of processes in user namespaces.
+	UserNamespaceIDs string `hcl:"user_namespace_ids"`
+
+	ContainerSelectors bool `hcl:"container_selectors"`
+	// RequireHostNamespaces refuses user attestation for processes outside
+	// the pid and user namespaces of the host init process.
+	RequireHostNamespaces bool `hcl:"require_host_namespaces"`
+
+	LoginSelectors bool `hcl:"login_selectors"`
+	// RequireLoginUserMatch requires the module's user to be the owner of the
+	// process login UID, so sudo'd processes attest as who ran sudo.
+	RequireLoginUserMatch bool `hcl:"require_login_user_match"`
+
+	// The revoked tokens are read from RevocationListFile or fetched from
+	// RevocationListURL, typically served by the auth service, every
+	// RevocationListRefreshInterval.
+	RevocationListFile            string `hcl:"revocation_list_file"`
+	RevocationListURL             string `hcl:"revocation_list_url"`
+	RevocationListRefreshInterval string `hcl:"revocation_list_refresh_interval"`
+	// RevocationListMaxAge fails attestations once the list could not be
+	// refreshed for that long.
+	RevocationListMaxAge string `hcl:"revocation_list_max_age"`
+
+	// TokenExpiryMargin rejects tokens expiring within that time, when the
+	// module or a validator reports the expiry.
+	TokenExpiryMargin string `hcl:"token_expiry_margin"`
+
+	// MetricsAddress, when set, is where the plugin serves its metrics as
+	// JSON on /debug/vars. An address without a host listens on loopback.
+	MetricsAddress string `hcl:"metrics_address"`
+
+	// ServiceAccounts, when set, attests the matching processes from their
+	// IDs only, so that system services on the node are attested too.
+	ServiceAccounts *ServiceAccountsConfig `hcl:"service_accounts"`
+
+	// Enforcement is "enforce", or "shadow" to only audit the attestations
+	// that would have been denied and return their selectors anyway.
+	Enforcement string `hcl:"enforcement"`
+
+	// LogExchanges logs the module responses and auth service exchanges at
+	// debug level, with tokens and secrets redacted.
+	LogExchanges bool `hcl:"log_exchanges"`
+
+	authServiceEndpoints    []string
+	authServiceTimeout      time.Duration
+	authServiceEjectionTime time.Duration
+	authServiceResetTimeout time.Duration
+	authServiceGracePeriod  time.Duration
+	sshCAKeys               []ssh.PublicKey
+	revocationRefresh       time.Duration
+	revocationMaxAge        time.Duration
+	tokenExpiryMargin       time.Duration
 }
 
 func parseConfig(hclConfig string) (*Config, error) {
@@ -16,5 +238,326 @@ func parseConfig(hclConfig string) (*Config, error) {
 	if err := hcl.Decode(config, hclConfig); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "failed to decode configuration: %v", err)
 	}
+
+	if err := validateModules(config); err != nil {
+		return nil, err
+	}
+
+	// The single URL keeps the highest priority so existing configurations
+	// behave the same when a list of fallbacks is added.
+	if config.UserAttestationServiceURL != "" {
+		config.authServiceEndpoints = append(config.authServiceEndpoints, config.UserAttestationServiceURL)
+	}
+	config.authServiceEndpoints = append(config.authServiceEndpoints, config.UserAttestationServiceURLs...)
+	if err := validateValidators(config); err != nil {
+		return nil, err
+	}
+	if len(config.authServiceEndpoints) == 0 && config.usesValidator(validatorAuthService) {
+		return nil, status.Error(codes.InvalidArgument, "user_attestation_service_url or user_attestation_service_urls is required")
+	}
+
+	switch config.AuthServiceLoadBalancing {
+	case "":
+		config.AuthServiceLoadBalancing = defaultAuthServiceLoadBalancing
+	case "failover", "round_robin", "least_latency":
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid auth_service_load_balancing %q: must be failover, round_robin or least_latency", config.AuthServiceLoadBalancing)
+	}
+
+	if config.AuthServiceOutlierFailures < 0 {
+		return nil, status.Error(codes.InvalidArgument, "auth_service_outlier_consecutive_failures cannot be negative")
+	}
+	if config.AuthServiceOutlierFailures == 0 {
+		config.AuthServiceOutlierFailures = defaultAuthServiceOutlierFailures
+	}
+
+	if config.AuthServiceFailureThreshold < 0 {
+		return nil, status.Error(codes.InvalidArgument, "auth_service_failure_threshold cannot be negative")
+	}
+	if config.AuthServiceFailureThreshold == 0 {
+		config.AuthServiceFailureThreshold = defaultAuthServiceFailureThreshold
+	}
+
+	var err error
+	if config.authServiceTimeout, err = parseDuration("auth_service_timeout", config.AuthServiceTimeout, defaultAuthServiceTimeout); err != nil {
+		return nil, err
+	}
+	if config.authServiceEjectionTime, err = parseDuration("auth_service_outlier_ejection_time", config.AuthServiceOutlierEjectionTime, defaultAuthServiceEjectionTime); err != nil {
+		return nil, err
+	}
+	if config.authServiceResetTimeout, err = parseDuration("auth_service_reset_timeout", config.AuthServiceResetTimeout, defaultAuthServiceResetTimeout); err != nil {
+		return nil, err
+	}
+	if config.authServiceGracePeriod, err = parseDuration("auth_service_grace_period", config.AuthServiceGracePeriod, defaultAuthServiceGracePeriod); err != nil {
+		return nil, err
+	}
+	if config.RevocationListFile != "" && config.RevocationListURL != "" {
+		return nil, status.Error(codes.InvalidArgument, "revocation_list_file and revocation_list_url cannot be combined")
+	}
+	if config.revocationRefresh, err = parseDuration("revocation_list_refresh_interval", config.RevocationListRefreshInterval, defaultRevocationRefreshInterval); err != nil {
+		return nil, err
+	}
+	if config.revocationMaxAge, err = parseDuration("revocation_list_max_age", config.RevocationListMaxAge, 0); err != nil {
+		return nil, err
+	}
+	if config.tokenExpiryMargin, err = parseDuration("token_expiry_margin", config.TokenExpiryMargin, 0); err != nil {
+		return nil, err
+	}
+	if config.ProcRoot == "" {
+		config.ProcRoot = defaultProcRoot
+	}
+	if config.EtcRoot == "" {
+		config.EtcRoot = defaultEtcRoot
+	}
+	switch config.GroupVerification {
+	case "":
+		config.GroupVerification = groupVerificationOff
+	case groupVerificationOff, groupVerificationDrop, groupVerificationReject:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid group_verification %q: must be off, drop or reject", config.GroupVerification)
+	}
+
+	switch config.UserNamespaceIDs {
+	case "":
+		config.UserNamespaceIDs = userNamespaceIDsOff
+	case userNamespaceIDsOff, userNamespaceIDsHost, userNamespaceIDsProcess:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid user_namespace_ids %q: must be off, host or process", config.UserNamespaceIDs)
+	}
+
+	switch config.Enforcement {
+	case "":
+		config.Enforcement = enforcementEnforce
+	case enforcementEnforce, enforcementShadow:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid enforcement %q: must be enforce or shadow", config.Enforcement)
+	}
+
+	switch config.ProcessGroupsCheck {
+	case "":
+		config.ProcessGroupsCheck = processGroupsCheckOff
+	case processGroupsCheckOff, processGroupsCheckIntersect, processGroupsCheckReject:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid process_groups_check %q: must be off, intersect or reject", config.ProcessGroupsCheck)
+	}
+
+	if err := parseSSHCAKeys(config); err != nil {
+		return nil, err
+	}
+
+	if config.LDAP != nil {
+		if err := validateLDAPConfig(config.LDAP); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ServiceAccounts != nil {
+		if err := validateServiceAccountsConfig(config.ServiceAccounts); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.usesValidator(validatorOIDC) && config.OIDC == nil {
+		return nil, status.Error(codes.InvalidArgument, "the oidc validator needs an oidc block")
+	}
+	if config.OIDC != nil {
+		if err := validateOIDCConfig(config.OIDC); err != nil {
+			return nil, err
+		}
+	}
 	return config, nil
 }
+
+func parseSSHCAKeys(config *Config) error {
+	authorizedKeys := config.SSHCAKeys
+	if config.SSHCAKeysFile != "" {
+		content, err := os.ReadFile(config.SSHCAKeysFile)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to read ssh_ca_keys_file: %v", err)
+		}
+		authorizedKeys = append(authorizedKeys, string(content))
+	}
+
+	var err error
+	if config.sshCAKeys, err = scAdptr.ParseCAKeys(authorizedKeys); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid ssh ca keys: %v", err)
+	}
+	if config.RequireSSHCertificate && len(config.sshCAKeys) == 0 {
+		return status.Error(codes.InvalidArgument, "require_ssh_certificate needs ssh_ca_keys or ssh_ca_keys_file")
+	}
+	return nil
+}
+
+func validateOIDCConfig(config *OIDCConfig) error {
+	if config.Issuer == "" {
+		return status.Error(codes.InvalidArgument, "oidc issuer is required")
+	}
+	if config.Audience == "" {
+		return status.Error(codes.InvalidArgument, "oidc audience is required")
+	}
+
+	var err error
+	if config.timeout, err = parseDuration("oidc timeout", config.Timeout, defaultOIDCTimeout); err != nil {
+		return err
+	}
+	if config.discoveryCacheTTL, err = parseDuration("oidc discovery_cache_ttl", config.DiscoveryCacheTTL, defaultOIDCDiscoveryCacheTTL); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateLDAPConfig(config *LDAPConfig) error {
+	if config.URL == "" {
+		return status.Error(codes.InvalidArgument, "ldap url is required")
+	}
+	if config.BaseDN == "" {
+		return status.Error(codes.InvalidArgument, "ldap base_dn is required")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = defaultLDAPUserFilter
+	}
+	if strings.Count(config.UserFilter, "%s") != 1 {
+		return status.Errorf(codes.InvalidArgument, "ldap user_filter %q must contain exactly one %%s", config.UserFilter)
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = defaultLDAPGroupAttribute
+	}
+
+	var err error
+	if config.timeout, err = parseDuration("ldap timeout", config.Timeout, defaultLDAPTimeout); err != nil {
+		return err
+	}
+	if config.cacheTTL, err = parseDuration("ldap cache_ttl", config.CacheTTL, defaultLDAPCacheTTL); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseDuration(name string, value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid %s %q: %v", name, value, err)
+	}
+	if duration <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be positive", name)
+	}
+	return duration, nil
+}
+
+func validateServiceAccountsConfig(config *ServiceAccountsConfig) error {
+	if len(config.UIDRanges) == 0 && len(config.Users) == 0 {
+		return status.Error(codes.InvalidArgument, "service_accounts needs uid_ranges or users")
+	}
+	var err error
+	if config.uidRanges, err = parseIDRanges("uid_ranges", config.UIDRanges); err != nil {
+		return err
+	}
+	if config.gidRanges, err = parseIDRanges("gid_ranges", config.GIDRanges); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateModules(config *Config) error {
+	switch config.ModulesMode {
+	case "":
+		config.ModulesMode = modulesModeFirstSuccess
+	case modulesModeFirstSuccess, modulesModeAllRequired, modulesModeMerge:
+	default:
+		return status.Errorf(codes.InvalidArgument, "invalid modules_mode %q: must be first_success, all_required or merge", config.ModulesMode)
+	}
+
+	if config.ModuleMinVersion != "" {
+		if _, err := uamAdptr.ParseVersion(config.ModuleMinVersion); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid module_min_version: %v", err)
+		}
+	}
+
+	// Without module blocks the single module socket is used, as it always was.
+	if len(config.Modules) == 0 {
+		config.Modules = []ModuleConfig{{
+			Name:       defaultModuleName,
+			Transport:  uamAdptr.TransportUnix,
+			Address:    config.UserAttestationModuleSocketPath,
+			MinVersion: config.ModuleMinVersion,
+		}}
+		return nil
+	}
+	if config.UserAttestationModuleSocketPath != "" {
+		return status.Error(codes.InvalidArgument, "user_attestation_module_path cannot be combined with module blocks")
+	}
+
+	seen := make(map[string]bool)
+	for i, module := range config.Modules {
+		if seen[module.Name] {
+			return status.Errorf(codes.InvalidArgument, "module %q is configured more than once", module.Name)
+		}
+		seen[module.Name] = true
+
+		switch module.Transport {
+		case "":
+			config.Modules[i].Transport = uamAdptr.TransportUnix
+		case uamAdptr.TransportUnix, uamAdptr.TransportTCP:
+		default:
+			return status.Errorf(codes.InvalidArgument, "invalid transport %q for module %q: must be unix or tcp", module.Transport, module.Name)
+		}
+		if module.Address == "" {
+			return status.Errorf(codes.InvalidArgument, "module %q needs an address", module.Name)
+		}
+		if strings.Contains(module.SelectorPrefix, ":") {
+			return status.Errorf(codes.InvalidArgument, "selector_prefix %q of module %q cannot contain ':'", module.SelectorPrefix, module.Name)
+		}
+		if module.MinVersion == "" {
+			config.Modules[i].MinVersion = config.ModuleMinVersion
+		} else if _, err := uamAdptr.ParseVersion(module.MinVersion); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid min_version of module %q: %v", module.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateValidators(config *Config) error {
+	// Without an explicit chain the auth service alone decides, as it always
+	// did. Without an endpoint either, attestations are not validated, which
+	// is what configurations leaving the URL empty always got.
+	if len(config.Validators) == 0 {
+		if len(config.authServiceEndpoints) > 0 {
+			config.Validators = []ValidatorConfig{{Name: validatorAuthService, Mode: string(validationModeRequired)}}
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for i, validator := range config.Validators {
+		switch validator.Name {
+		case validatorAuthService, validatorLocalAccount, validatorOIDC:
+		default:
+			return status.Errorf(codes.InvalidArgument, "unknown validator %q", validator.Name)
+		}
+		if seen[validator.Name] {
+			return status.Errorf(codes.InvalidArgument, "validator %q is configured more than once", validator.Name)
+		}
+		seen[validator.Name] = true
+
+		switch validationMode(validator.Mode) {
+		case "":
+			config.Validators[i].Mode = string(validationModeRequired)
+		case validationModeRequired, validationModeRequisite, validationModeSufficient, validationModeOptional:
+		default:
+			return status.Errorf(codes.InvalidArgument, "invalid mode %q for validator %q: must be required, requisite, sufficient or optional", validator.Mode, validator.Name)
+		}
+	}
+	return nil
+}
+
+func (config *Config) usesValidator(name string) bool {
+	for _, validator := range config.Validators {
+		if validator.Name == name {
+			return true
+		}
+	}
+	return false
+}
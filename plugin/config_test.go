@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"google.golang.org/grpc/codes"
+)
+
+// TestShippedConfigurationParses keeps configuration.hcl usable as is.
+func TestShippedConfigurationParses(t *testing.T) {
+	content, err := os.ReadFile("../configuration.hcl")
+	if err != nil {
+		t.Fatalf("failed to read configuration.hcl: %v", err)
+	}
+	file, err := hcl.ParseBytes(content)
+	if err != nil {
+		t.Fatalf("failed to parse configuration.hcl: %v", err)
+	}
+	object := singleBlock(t, file.Node.(*ast.ObjectList), "WorkloadAttestor", "user")
+	object = singleBlock(t, object.List, "plugin_data")
+
+	var hclConfig strings.Builder
+	if err := printer.Fprint(&hclConfig, object.List); err != nil {
+		t.Fatalf("failed to print plugin_data: %v", err)
+	}
+	config, err := parseConfig(hclConfig.String())
+	if err != nil {
+		t.Fatalf("parseConfig rejected the shipped configuration: %v", err)
+	}
+	if len(config.authServiceEndpoints) != 1 {
+		t.Errorf("expected the example auth service endpoint, got %v", config.authServiceEndpoints)
+	}
+}
+
+func singleBlock(t *testing.T, list *ast.ObjectList, keys ...string) *ast.ObjectType {
+	t.Helper()
+	items := list.Filter(keys...).Items
+	if len(items) != 1 {
+		t.Fatalf("expected a single %s block, got %d", strings.Join(keys, " "), len(items))
+	}
+	object, ok := items[0].Val.(*ast.ObjectType)
+	if !ok {
+		t.Fatalf("expected %s to be a block", strings.Join(keys, " "))
+	}
+	return object
+}
+
+func TestModuleMinVersion(t *testing.T) {
+	config, err := parseConfig(`
+		user_attestation_service_url = "http://127.0.0.1:8080/validate"
+		module_min_version = "1.4"
+		module "laptop" {
+			address = "/run/laptop.sock"
+		}
+		module "sso" {
+			address = "/run/sso.sock"
+			min_version = "v2.0.1"
+		}
+	`)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if config.Modules[0].MinVersion != "1.4" || config.Modules[1].MinVersion != "v2.0.1" {
+		t.Errorf("expected the default to apply to laptop only, got %+v", config.Modules)
+	}
+
+	config, err = parseConfig(`
+		user_attestation_service_url = "http://127.0.0.1:8080/validate"
+		user_attestation_module_path = "/run/module.sock"
+		module_min_version = "1.4"
+	`)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if config.Modules[0].MinVersion != "1.4" {
+		t.Errorf("expected the default module to get the minimum version, got %+v", config.Modules[0])
+	}
+
+	for _, invalid := range []string{
+		`module_min_version = "latest"`,
+		`module "laptop" {
+			address = "/run/laptop.sock"
+			min_version = "1.x"
+		}`,
+	} {
+		_, err := parseConfig(`user_attestation_service_url = "http://127.0.0.1:8080/validate"` + "\n" + invalid)
+		requireCode(t, err, codes.InvalidArgument)
+	}
+}
+
+func TestAuthServiceValidatorNeedsAnEndpoint(t *testing.T) {
+	// Configurations leaving the URL empty load without validators, as they
+	// always did.
+	config, err := parseConfig(`
+		user_attestation_service_url = ""
+		user_attestation_module_path = "/run/module.sock"
+	`)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if len(config.Validators) != 0 {
+		t.Errorf("expected no validator, got %+v", config.Validators)
+	}
+
+	config, err = parseConfig(`user_attestation_service_urls = ["http://127.0.0.1:8080/validate"]`)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if len(config.Validators) != 1 || config.Validators[0].Name != validatorAuthService {
+		t.Errorf("expected the auth service validator by default, got %+v", config.Validators)
+	}
+
+	_, err = parseConfig(`validator "auth_service" { mode = "required" }`)
+	requireCode(t, err, codes.InvalidArgument)
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	pfAdptr "wl/plugin/infrastructure/procfs"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const hostInitPid = 1
+
+var hostNamespaces = []string{"pid", "user"}
+
+func (p *Plugin) getContainerSelectors(config *Config, pid int32) ([]string, error) {
+	procFS := pfAdptr.ProcFS{Root: config.ProcRoot}
+
+	cgroups, err := procFS.Cgroups(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process cgroups", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read cgroups of process %d: %v", pid, err)
+	}
+
+	selectors := []string{}
+	selectors = appendSelector(selectors, "cgroup:path", pfAdptr.CgroupPath(cgroups))
+	if container, ok := pfAdptr.DetectContainer(cgroups); ok {
+		selectors = appendSelector(selectors, "container:id", container.ID)
+		selectors = appendSelector(selectors, "container:runtime", container.Runtime)
+	}
+	for _, namespace := range hostNamespaces {
+		inode, err := procFS.Namespace(pid, namespace)
+		if err != nil {
+			p.logger.Error("Failed to read the process namespace", "pid", pid, "namespace", namespace, "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to read %s namespace of process %d: %v", namespace, pid, err)
+		}
+		selectors = appendSelector(selectors, "ns:"+namespace, inode)
+	}
+	return selectors, nil
+}
+
+// checkHostNamespaces rejects processes that do not share the pid and user
+// namespaces of the host init process, such as processes in containers that
+// merely run with the UID of a host user.
+func (p *Plugin) checkHostNamespaces(config *Config, pid int32) error {
+	procFS := pfAdptr.ProcFS{Root: config.ProcRoot}
+	for _, namespace := range hostNamespaces {
+		hostInode, err := procFS.Namespace(hostInitPid, namespace)
+		if err != nil {
+			p.logger.Error("Failed to read the host namespace", "namespace", namespace, "error", err)
+			return status.Errorf(codes.Internal, "failed to read host %s namespace: %v", namespace, err)
+		}
+		inode, err := procFS.Namespace(pid, namespace)
+		if err != nil {
+			p.logger.Error("Failed to read the process namespace", "pid", pid, "namespace", namespace, "error", err)
+			return status.Errorf(codes.Internal, "failed to read %s namespace of process %d: %v", namespace, pid, err)
+		}
+		if inode != hostInode {
+			p.logger.Warn("Refusing user attestation for a process outside the host namespaces", "pid", pid, "namespace", namespace)
+			return status.Errorf(codes.PermissionDenied, "process %d is not in the host %s namespace", pid, namespace)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestGetContainerSelectors(t *testing.T) {
+	p, config := newInspectionTest(t, `container_selectors = true`)
+
+	selectors, err := p.getContainerSelectors(config, containerPid)
+	if err != nil {
+		t.Fatalf("getContainerSelectors failed: %v", err)
+	}
+	expected := []string{
+		"cgroup:path:/user.slice/user-1001.slice/user@1001.service/user.slice/docker-3f4b6c2a9d8e7f1a0b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a.scope",
+		"container:id:3f4b6c2a9d8e7f1a0b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a",
+		"container:runtime:docker",
+		"ns:pid:4026532301",
+		"ns:user:4026532300",
+	}
+	if !slices.Equal(selectors, expected) {
+		t.Errorf("expected %v, got %v", expected, selectors)
+	}
+
+	selectors, err = p.getContainerSelectors(config, hostPid)
+	if err != nil {
+		t.Fatalf("getContainerSelectors failed: %v", err)
+	}
+	expected = []string{"cgroup:path:/user.slice/user-1001.slice/session-7.scope", "ns:pid:4026531836", "ns:user:4026531837"}
+	if !slices.Equal(selectors, expected) {
+		t.Errorf("expected %v, got %v", expected, selectors)
+	}
+}
+
+func TestCheckHostNamespaces(t *testing.T) {
+	p, config := newInspectionTest(t, `require_host_namespaces = true`)
+
+	if err := p.checkHostNamespaces(config, hostPid); err != nil {
+		t.Fatalf("expected the host process to pass, got %v", err)
+	}
+	requireCode(t, p.checkHostNamespaces(config, containerPid), codes.PermissionDenied)
+	requireCode(t, p.checkHostNamespaces(config, 9999), codes.Internal)
+
+	config.ProcRoot = writeProcess(t, hostPid, nil)
+	requireCode(t, p.checkHostNamespaces(config, hostPid), codes.Internal)
+}
+
+func TestGetContainerSelectorsErrors(t *testing.T) {
+	p, config := newInspectionTest(t, `container_selectors = true`)
+
+	_, err := p.getContainerSelectors(config, 9999)
+	requireCode(t, err, codes.Internal)
+
+	// Processes whose namespaces cannot be read are not attested without them.
+	config.ProcRoot = writeProcess(t, hostPid, map[string]string{"cgroup": "0::/init.scope\n"})
+	_, err = p.getContainerSelectors(config, hostPid)
+	requireCode(t, err, codes.Internal)
+}
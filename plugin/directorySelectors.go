@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"os"
+	"sort"
+	"wl/plugin/domain"
+	ldAdptr "wl/plugin/infrastructure/ldapDirectory"
+	"wl/plugin/presentation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newLDAPDirectory(config *LDAPConfig) (presentation.UserDirectory, error) {
+	ldapURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ldap url %q: %v", config.URL, err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         ldapURL.Hostname(),
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		caPEM, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to read ldap ca_file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, status.Errorf(codes.InvalidArgument, "ldap ca_file %q contains no certificates", config.CAFile)
+		}
+	}
+
+	return ldAdptr.NewLDAPDirectoryAdaptor(ldAdptr.LDAPDirectoryOptions{
+		URL:            config.URL,
+		BindDN:         config.BindDN,
+		BindPassword:   config.BindPassword,
+		BaseDN:         config.BaseDN,
+		UserFilter:     config.UserFilter,
+		GroupAttribute: config.GroupAttribute,
+		Attributes:     config.Attributes,
+		StartTLS:       config.StartTLS,
+		TLSConfig:      tlsConfig,
+		Timeout:        config.timeout,
+		CacheTTL:       config.cacheTTL,
+	}), nil
+}
+
+func (p *Plugin) getDirectorySelectors(userDirectory presentation.UserDirectory, username string, required bool) ([]string, error) {
+	user, err := userDirectory.LookupUser(username)
+	switch {
+	case errors.Is(err, ldAdptr.ErrUserNotFound):
+		p.logger.Debug("User not found in directory", "user", username)
+		return nil, nil
+	case err != nil:
+		if required {
+			p.logger.Error("Failed to look up user in directory", "user", username, "error", err)
+			return nil, status.Errorf(codes.Unavailable, "failed to look up user in directory: %v", err)
+		}
+		p.logger.Warn("Failed to look up user in directory, attesting without directory selectors", "user", username, "error", err)
+		return nil, nil
+	}
+	return buildDirectorySelectors(user), nil
+}
+
+func buildDirectorySelectors(user *domain.DirectoryUser) []string {
+	selectors := []string{}
+	for _, group := range user.Groups {
+		selectors = appendSelector(selectors, "ldap:group", group)
+	}
+
+	attributes := make([]string, 0, len(user.Attributes))
+	for attribute := range user.Attributes {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	for _, attribute := range attributes {
+		for _, value := range user.Attributes[attribute] {
+			selectors = appendSelector(selectors, "ldap:attr", attribute, value)
+		}
+	}
+	return selectors
+}
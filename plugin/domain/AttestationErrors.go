@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MaxValueLength is the longest name or ID accepted from a module, well above
+// what account databases allow.
+const MaxValueLength = 256
+
+// Fields are named as in the module protocol, so that module authors and
+// operators can find them.
+const (
+	FieldName                   = "user_info.name"
+	FieldUserID                 = "user_info.system_info.user_id"
+	FieldUsername               = "user_info.system_info.username"
+	FieldGroupID                = "user_info.system_info.group_id"
+	FieldGroupName              = "user_info.system_info.group_name"
+	FieldSupplementaryGroupID   = "user_info.system_info.supplementary_groups.group_id"
+	FieldSupplementaryGroupName = "user_info.system_info.supplementary_groups.group_name"
+)
+
+// MissingFieldError is returned when a module leaves out a field every
+// attestation needs. Field names all the fields when any of them would do.
+type MissingFieldError struct {
+	Field string
+}
+
+func (err *MissingFieldError) Error() string {
+	return fmt.Sprintf("missing %s", err.Field)
+}
+
+// InvalidIDError is returned for a user or group ID that is not a numeric
+// POSIX ID.
+type InvalidIDError struct {
+	Field string
+	Value string
+}
+
+func (err *InvalidIDError) Error() string {
+	return fmt.Sprintf("%s %q is not a numeric id", err.Field, err.Value)
+}
+
+// DuplicateGroupError is returned when a supplementary group is reported
+// more than once, which a consistent module never does.
+type DuplicateGroupError struct {
+	GroupID   string
+	GroupName string
+}
+
+func (err *DuplicateGroupError) Error() string {
+	return fmt.Sprintf("supplementary group %q (%s) is reported more than once", err.GroupName, err.GroupID)
+}
+
+// OversizedValueError is returned for a value longer than MaxValueLength.
+type OversizedValueError struct {
+	Field  string
+	Length int
+}
+
+func (err *OversizedValueError) Error() string {
+	return fmt.Sprintf("%s is %d bytes long, more than the %d allowed", err.Field, err.Length, MaxValueLength)
+}
+
+// Validate checks the invariants of the user a module reported. All problems
+// are returned, joined, so that a broken module can be fixed in one go.
+// Either the user ID or the username is enough, account verification fills
+// in the other one.
+func (attestation *UserAttestation) Validate() error {
+	user := attestation.UserInfo
+	system := user.SystemInfo
+	errs := []error{
+		required(FieldName, user.Name),
+		requiredOneOf(FieldUserID, system.UserID, FieldUsername, system.Username),
+		id(FieldUserID, system.UserID),
+		id(FieldGroupID, system.GroupID),
+		bounded(FieldName, user.Name),
+		bounded(FieldUsername, system.Username),
+		bounded(FieldGroupName, system.GroupName),
+	}
+
+	seen := make(map[GroupInfo]bool, len(system.SupplementaryGroups))
+	for _, group := range system.SupplementaryGroups {
+		if group.GroupID == "" && group.GroupName == "" {
+			errs = append(errs, &MissingFieldError{Field: FieldSupplementaryGroupID})
+			continue
+		}
+		errs = append(errs,
+			id(FieldSupplementaryGroupID, group.GroupID),
+			bounded(FieldSupplementaryGroupName, group.GroupName),
+		)
+		// Groups without an ID are told apart by name.
+		key := GroupInfo{GroupID: group.GroupID}
+		if key.GroupID == "" {
+			key.GroupName = group.GroupName
+		}
+		if seen[key] {
+			errs = append(errs, &DuplicateGroupError{GroupID: group.GroupID, GroupName: group.GroupName})
+		}
+		seen[key] = true
+	}
+	return errors.Join(errs...)
+}
+
+func required(field, value string) error {
+	if value == "" {
+		return &MissingFieldError{Field: field}
+	}
+	return nil
+}
+
+func requiredOneOf(field, value, otherField, otherValue string) error {
+	if value == "" && otherValue == "" {
+		return &MissingFieldError{Field: field + " or " + otherField}
+	}
+	return nil
+}
+
+// id accepts an empty value, which required rejects where it matters.
+func id(field, value string) error {
+	if value == "" || len(value) > MaxValueLength {
+		return bounded(field, value)
+	}
+	if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+		return &InvalidIDError{Field: field, Value: value}
+	}
+	return nil
+}
+
+func bounded(field, value string) error {
+	if len(value) > MaxValueLength {
+		return &OversizedValueError{Field: field, Length: len(value)}
+	}
+	return nil
+}
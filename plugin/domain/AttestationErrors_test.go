@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func validUser() UserAttestation {
+	return UserAttestation{UserInfo: UserInfo{
+		Name: "alice",
+		SystemInfo: SystemInfo{
+			UserID:              "1001",
+			Username:            "alice",
+			GroupID:             "1001",
+			GroupName:           "alice",
+			SupplementaryGroups: []GroupInfo{{GroupID: "27", GroupName: "sudo"}, {GroupName: "docker"}},
+		},
+	}}
+}
+
+func TestValidateAcceptsUsers(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(attestation *UserAttestation)
+	}{
+		{name: "complete user", change: func(*UserAttestation) {}},
+		{name: "user id only", change: func(a *UserAttestation) { a.UserInfo.SystemInfo.Username = "" }},
+		{name: "username only", change: func(a *UserAttestation) { a.UserInfo.SystemInfo.UserID = "" }},
+		{name: "no groups", change: func(a *UserAttestation) { a.UserInfo.SystemInfo = SystemInfo{UserID: "1001"} }},
+		{name: "inner ids left to the plugin", change: func(a *UserAttestation) {
+			a.UserInfo.SystemInfo.InnerUserID = "not numeric"
+			a.UserInfo.SystemInfo.SupplementaryGroups[0].InnerGroupID = "-1"
+		}},
+		{name: "longest value", change: func(a *UserAttestation) { a.UserInfo.Name = strings.Repeat("a", MaxValueLength) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attestation := validUser()
+			tc.change(&attestation)
+			if err := attestation.Validate(); err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsUsers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		change   func(attestation *UserAttestation)
+		expected error
+	}{
+		{
+			name:     "no name",
+			change:   func(a *UserAttestation) { a.UserInfo.Name = "" },
+			expected: &MissingFieldError{Field: FieldName},
+		},
+		{
+			name:     "neither user id nor username",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.UserID, a.UserInfo.SystemInfo.Username = "", "" },
+			expected: &MissingFieldError{Field: FieldUserID + " or " + FieldUsername},
+		},
+		{
+			name:     "group without id and name",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.SupplementaryGroups[1] = GroupInfo{} },
+			expected: &MissingFieldError{Field: FieldSupplementaryGroupID},
+		},
+		{
+			name:     "user id with a name",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.UserID = "alice" },
+			expected: &InvalidIDError{Field: FieldUserID, Value: "alice"},
+		},
+		{
+			name:     "negative group id",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.GroupID = "-1" },
+			expected: &InvalidIDError{Field: FieldGroupID, Value: "-1"},
+		},
+		{
+			name:     "group id beyond 32 bits",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.SupplementaryGroups[0].GroupID = "4294967296" },
+			expected: &InvalidIDError{Field: FieldSupplementaryGroupID, Value: "4294967296"},
+		},
+		{
+			name:     "oversized username",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.Username = strings.Repeat("a", MaxValueLength+1) },
+			expected: &OversizedValueError{Field: FieldUsername, Length: MaxValueLength + 1},
+		},
+		{
+			name:     "oversized user id",
+			change:   func(a *UserAttestation) { a.UserInfo.SystemInfo.UserID = strings.Repeat("1", MaxValueLength+1) },
+			expected: &OversizedValueError{Field: FieldUserID, Length: MaxValueLength + 1},
+		},
+		{
+			name: "oversized group name",
+			change: func(a *UserAttestation) {
+				a.UserInfo.SystemInfo.SupplementaryGroups[0].GroupName = strings.Repeat("a", MaxValueLength+1)
+			},
+			expected: &OversizedValueError{Field: FieldSupplementaryGroupName, Length: MaxValueLength + 1},
+		},
+		{
+			name: "duplicate group id",
+			change: func(a *UserAttestation) {
+				a.UserInfo.SystemInfo.SupplementaryGroups = append(a.UserInfo.SystemInfo.SupplementaryGroups, GroupInfo{GroupID: "27", GroupName: "wheel"})
+			},
+			expected: &DuplicateGroupError{GroupID: "27", GroupName: "wheel"},
+		},
+		{
+			name: "duplicate group name without id",
+			change: func(a *UserAttestation) {
+				a.UserInfo.SystemInfo.SupplementaryGroups = append(a.UserInfo.SystemInfo.SupplementaryGroups, GroupInfo{GroupName: "docker"})
+			},
+			expected: &DuplicateGroupError{GroupName: "docker"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attestation := validUser()
+			tc.change(&attestation)
+			err := attestation.Validate()
+			if err == nil {
+				t.Fatal("expected Validate to fail")
+			}
+			if err.Error() != tc.expected.Error() {
+				t.Errorf("expected %q, got %q", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	attestation := validUser()
+	attestation.UserInfo.Name = ""
+	attestation.UserInfo.SystemInfo.GroupID = "staff"
+	attestation.UserInfo.SystemInfo.SupplementaryGroups = append(attestation.UserInfo.SystemInfo.SupplementaryGroups, GroupInfo{GroupID: "27"})
+
+	err := attestation.Validate()
+	var missingErr *MissingFieldError
+	var invalidErr *InvalidIDError
+	var duplicateErr *DuplicateGroupError
+	if !errors.As(err, &missingErr) || !errors.As(err, &invalidErr) || !errors.As(err, &duplicateErr) {
+		t.Fatalf("expected every problem to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+package domain
+
+type DirectoryUser struct {
+	DN         string
+	Groups     []string
+	Attributes map[string][]string
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "slices"
+
+type ModuleFeature string
+
+const (
+	FeatureNonce      ModuleFeature = "nonce"
+	FeatureSignatures ModuleFeature = "signatures"
+	FeaturePIDBinding ModuleFeature = "pid_binding"
+	FeatureStreaming  ModuleFeature = "streaming"
+)
+
+// ModuleCapabilities is what the plugin and a module agreed on when they
+// connected.
+type ModuleCapabilities struct {
+	Name            string
+	Version         string
+	ProtocolVersion uint32
+	Features        []ModuleFeature
+}
+
+func (capabilities ModuleCapabilities) Supports(feature ModuleFeature) bool {
+	return slices.Contains(capabilities.Features, feature)
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "strings"
+
+type PolicyInput struct {
+	Attestation UserAttestation
+	Process     ProcessInfo
+	Validation  UserAttestationValidation
+}
+
+type PolicyDecision struct {
+	Allowed         bool
+	DeniedBy        string
+	Message         string
+	AddSelectors    []string
+	RemoveSelectors []string
+}
+
+// ApplyTo removes the selectors matching RemoveSelectors, where a trailing "*"
+// matches any suffix, and appends AddSelectors.
+func (decision PolicyDecision) ApplyTo(selectors []string) []string {
+	result := []string{}
+	for _, selector := range selectors {
+		if !matchesAny(selector, decision.RemoveSelectors) {
+			result = append(result, selector)
+		}
+	}
+	return append(result, decision.AddSelectors...)
+}
+
+func matchesAny(selector string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(selector, prefix) {
+				return true
+			}
+		} else if selector == pattern {
+			return true
+		}
+	}
+	return false
+}
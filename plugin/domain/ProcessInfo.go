@@ -0,0 +1,10 @@
+package domain
+
+type ProcessInfo struct {
+	Pid     int32
+	Name    string
+	Exe     string
+	Cmdline []string
+	UIDs    []string
+	GIDs    []string
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+type SSHIdentity struct {
+	KeyID       string
+	Principals  []string
+	Extensions  map[string]string
+	ValidBefore time.Time
+}
@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+type SessionEventType string
+
+const (
+	SessionLogin         SessionEventType = "login"
+	SessionLogout        SessionEventType = "logout"
+	SessionLock          SessionEventType = "lock"
+	SessionUnlock        SessionEventType = "unlock"
+	SessionTokenRotation SessionEventType = "token_rotation"
+)
+
+type SessionEvent struct {
+	Type SessionEventType
+	// UserName is the UserInfo.Name of the user the event is about.
+	UserName  string
+	UserID    string
+	SessionID string
+	Time      time.Time
+}
+
+// EndsAttestations tells whether attestations made before the event must not
+// be reused after it.
+func (event SessionEvent) EndsAttestations() bool {
+	switch event.Type {
+	case SessionLogout, SessionLock, SessionTokenRotation:
+		return true
+	}
+	return false
+}
@@ -1,8 +1,26 @@
 package domain
 
+import "time"
+
 type UserAttestation struct {
-	Token    string
-	UserInfo UserInfo
+	Token string
+	// TokenExpiresAt is when the module says Token expires, zero when unknown.
+	TokenExpiresAt time.Time
+	UserInfo       UserInfo
+	SSHCertificate string
+	SSHSignature   []byte
+	// Nonce is the challenge the plugin sent to the module for this attestation.
+	Nonce []byte
+	// Sources are the modules that reported this user, in configuration order.
+	Sources []AttestationSource
+}
+
+// AttestationSource is what a single module reported when several modules
+// are combined into one attestation.
+type AttestationSource struct {
+	Module         string
+	SelectorPrefix string
+	UserInfo       UserInfo
 }
 
 type UserInfo struct {
@@ -17,9 +35,14 @@ type SystemInfo struct {
 	GroupID             string
 	GroupName           string
 	SupplementaryGroups []GroupInfo
+	// InnerUserID and InnerGroupID are the IDs as seen inside the user
+	// namespace of the process, set only when it is not the host namespace.
+	InnerUserID  string
+	InnerGroupID string
 }
 
 type GroupInfo struct {
-	GroupID   string
-	GroupName string
+	GroupID      string
+	GroupName    string
+	InnerGroupID string
 }
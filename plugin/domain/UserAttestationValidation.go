@@ -1,6 +1,31 @@
 package domain
 
+import "time"
+
 type UserAttestationValidation struct {
+	IsValid  bool
+	Message  string
+	Degraded bool
+	Steps    []ValidationStep
+	// Selectors describe the identity established by the validation, e.g.
+	// claims of a verified token.
+	Selectors []string
+	// ExpiresAt is when the validated credential expires, zero when unknown.
+	ExpiresAt time.Time
+}
+
+// EarlierExpiry returns the earlier of two expiries, a zero time meaning
+// that the expiry is unknown.
+func EarlierExpiry(expiry, other time.Time) time.Time {
+	if expiry.IsZero() || (!other.IsZero() && other.Before(expiry)) {
+		return other
+	}
+	return expiry
+}
+
+type ValidationStep struct {
+	Name    string
+	Mode    string
 	IsValid bool
 	Message string
 }
@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"google.golang.org/grpc/status"
+)
+
+const (
+	enforcementEnforce = "enforce"
+	enforcementShadow  = "shadow"
+)
+
+// enforcer decides what a failed check does to an attestation. Enforced, the
+// attestation fails. In shadow mode the failure is audited instead, and the
+// attestation goes on with the selectors it would have without that check.
+type enforcer struct {
+	p       *Plugin
+	shadow  bool
+	pid     int32
+	denials int
+}
+
+func (p *Plugin) newEnforcer(config *Config, pid int32) *enforcer {
+	return &enforcer{p: p, shadow: config.Enforcement == enforcementShadow, pid: pid}
+}
+
+// check returns err when it is enforced, and nil otherwise.
+func (e *enforcer) check(err error) error {
+	if err == nil || !e.shadow {
+		return err
+	}
+	e.denials++
+	e.p.logger.Warn("Attestation would have been denied",
+		"audit", true,
+		"enforcement", enforcementShadow,
+		"pid", e.pid,
+		"code", status.Code(err),
+		"error", err,
+	)
+	return nil
+}
+
+// done counts the attestations that would have been denied.
+func (e *enforcer) done() {
+	if e.denials > 0 {
+		metrics.Add("shadow_denied_attestations", 1)
+		metrics.Add("shadow_denials", int64(e.denials))
+	}
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"encoding/json"
+	uasAdptr "wl/plugin/infrastructure/userAuthService"
+
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/protobuf/proto"
+)
+
+// unparsableExchangeBody is logged instead of the bodies of an auth service
+// exchange whose request could not be parsed.
+const unparsableExchangeBody = "redacted:unparsable"
+
+// moduleExchangeLogger returns the hook logging what a module answers when
+// log_exchanges is enabled. The logger redacts the token and the secret.
+func moduleExchangeLogger(config *Config, logger hclog.Logger, module string) func(req, res proto.Message, err error) {
+	if !config.LogExchanges || logger == nil {
+		return nil
+	}
+	return func(req, res proto.Message, err error) {
+		logger.Debug("User attestation module exchange",
+			"module", module,
+			"request", req,
+			"response", res,
+			"error", err,
+		)
+	}
+}
+
+// authServiceExchangeLogger returns the hook logging the validation requests
+// and answers of the auth service when log_exchanges is enabled.
+func authServiceExchangeLogger(config *Config, logger hclog.Logger) func(exchange uasAdptr.AuthServiceExchange) {
+	if !config.LogExchanges || logger == nil {
+		return nil
+	}
+	return func(exchange uasAdptr.AuthServiceExchange) {
+		// The answer may quote the credentials of the request, which cannot be
+		// found in either when the request does not parse.
+		var request struct {
+			Token    string `json:"token"`
+			UserInfo struct {
+				Secret string `json:"secret"`
+			} `json:"user_info"`
+		}
+		var requestBody, responseBody any = unparsableExchangeBody, unparsableExchangeBody
+		if err := json.Unmarshal(exchange.Request, &request); err == nil {
+			requestBody = json.RawMessage(exchange.Request)
+			responseBody = json.RawMessage(redactSecrets(string(exchange.Response), request.Token, request.UserInfo.Secret))
+		}
+
+		logger.Debug("Auth service exchange",
+			"url", exchange.URL,
+			"status", exchange.StatusCode,
+			"request_header", exchange.RequestHeader,
+			"request", requestBody,
+			"response_header", exchange.ResponseHeader,
+			"response", responseBody,
+		)
+	}
+}
@@ -0,0 +1,137 @@
+package infrastructure
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type Account struct {
+	Username string
+	UserID   string
+	GroupID  string
+}
+
+type Group struct {
+	Name    string
+	GroupID string
+	Members []string
+}
+
+// AccountDatabase reads the passwd and group files found under EtcDir.
+type AccountDatabase struct {
+	EtcDir string
+}
+
+func (db AccountDatabase) LookupUser(username string) (*Account, error) {
+	return db.findAccount(func(account *Account) bool { return account.Username == username })
+}
+
+func (db AccountDatabase) LookupUserID(userID string) (*Account, error) {
+	return db.findAccount(func(account *Account) bool { return account.UserID == userID })
+}
+
+func (db AccountDatabase) LookupGroup(name string) (*Group, error) {
+	return db.findGroup(func(group *Group) bool { return group.Name == name })
+}
+
+func (db AccountDatabase) LookupGroupID(groupID string) (*Group, error) {
+	return db.findGroup(func(group *Group) bool { return group.GroupID == groupID })
+}
+
+// IsMember reports whether the account belongs to the group, either as its
+// primary group or through the member list of the group file.
+func (db AccountDatabase) IsMember(account *Account, group *Group) bool {
+	if account.GroupID == group.GroupID {
+		return true
+	}
+	for _, member := range group.Members {
+		if member == account.Username {
+			return true
+		}
+	}
+	return false
+}
+
+func (db AccountDatabase) findGroup(match func(*Group) bool) (*Group, error) {
+	var found *Group
+	err := db.scan("group", func(fields []string) bool {
+		if len(fields) < 3 {
+			return false
+		}
+		group := &Group{Name: fields[0], GroupID: fields[2]}
+		if len(fields) > 3 && fields[3] != "" {
+			group.Members = strings.Split(fields[3], ",")
+		}
+		if match(group) {
+			found = group
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (db AccountDatabase) findAccount(match func(*Account) bool) (*Account, error) {
+	var found *Account
+	err := db.scan("passwd", func(fields []string) bool {
+		if len(fields) < 4 {
+			return false
+		}
+		account := &Account{Username: fields[0], UserID: fields[2], GroupID: fields[3]}
+		if match(account) {
+			found = account
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (db AccountDatabase) scan(file string, visit func(fields []string) bool) error {
+	path := filepath.Join(db.etcDir(), file)
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if visit(strings.Split(line, ":")) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+func (db AccountDatabase) etcDir() string {
+	if db.EtcDir == "" {
+		return "/etc"
+	}
+	return db.EtcDir
+}
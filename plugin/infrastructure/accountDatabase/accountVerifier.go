@@ -0,0 +1,108 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"wl/plugin/domain"
+)
+
+var ErrAccountMismatch = errors.New("account mismatch")
+
+// AccountVerifier cross-checks the user and groups reported by the module with
+// the account database and fills in the names or IDs the module left out.
+type AccountVerifier struct {
+	Database AccountDatabase
+}
+
+// Verify returns a copy of the attestation with resolved user and groups, and
+// a description of every supplementary group the user is not a member of;
+// those groups are left out of the copy. A user or primary group that does
+// not match the database fails with ErrAccountMismatch.
+func (verifier AccountVerifier) Verify(data *domain.UserAttestation) (*domain.UserAttestation, []string, error) {
+	verified := *data
+	systemInfo := &verified.UserInfo.SystemInfo
+
+	account, err := verifier.resolveAccount(systemInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	systemInfo.UserID = account.UserID
+	systemInfo.Username = account.Username
+
+	if systemInfo.GroupID == "" && systemInfo.GroupName == "" {
+		systemInfo.GroupID = account.GroupID
+	}
+	primary, reason, err := verifier.resolveGroup(account, domain.GroupInfo{GroupID: systemInfo.GroupID, GroupName: systemInfo.GroupName})
+	if err != nil {
+		return nil, nil, err
+	}
+	if reason != "" {
+		return nil, nil, fmt.Errorf("%w: primary %s", ErrAccountMismatch, reason)
+	}
+	systemInfo.GroupID = primary.GroupID
+	systemInfo.GroupName = primary.Name
+
+	dropped := []string{}
+	groups := []domain.GroupInfo{}
+	for _, reported := range data.UserInfo.SystemInfo.SupplementaryGroups {
+		group, reason, err := verifier.resolveGroup(account, reported)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			dropped = append(dropped, reason)
+			continue
+		}
+		groups = append(groups, domain.GroupInfo{GroupID: group.GroupID, GroupName: group.Name, InnerGroupID: reported.InnerGroupID})
+	}
+	systemInfo.SupplementaryGroups = groups
+	return &verified, dropped, nil
+}
+
+func (verifier AccountVerifier) resolveAccount(systemInfo *domain.SystemInfo) (*Account, error) {
+	var account *Account
+	var err error
+	switch {
+	case systemInfo.UserID != "":
+		account, err = verifier.Database.LookupUserID(systemInfo.UserID)
+	case systemInfo.Username != "":
+		account, err = verifier.Database.LookupUser(systemInfo.Username)
+	default:
+		return nil, fmt.Errorf("%w: module reported neither a user id nor a username", ErrAccountMismatch)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: user %s/%q does not exist", ErrAccountMismatch, systemInfo.UserID, systemInfo.Username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if systemInfo.Username != "" && systemInfo.Username != account.Username {
+		return nil, fmt.Errorf("%w: uid %s belongs to %q, module reported %q", ErrAccountMismatch, account.UserID, account.Username, systemInfo.Username)
+	}
+	return account, nil
+}
+
+// resolveGroup looks the reported group up by ID, or by name when only the
+// name is known, and returns why it cannot be attributed to the account.
+func (verifier AccountVerifier) resolveGroup(account *Account, reported domain.GroupInfo) (*Group, string, error) {
+	var group *Group
+	var err error
+	if reported.GroupID != "" {
+		group, err = verifier.Database.LookupGroupID(reported.GroupID)
+	} else {
+		group, err = verifier.Database.LookupGroup(reported.GroupName)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Sprintf("group %s/%q does not exist", reported.GroupID, reported.GroupName), nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if reported.GroupName != "" && reported.GroupName != group.Name {
+		return nil, fmt.Sprintf("gid %s belongs to %q, module reported %q", group.GroupID, group.Name, reported.GroupName), nil
+	}
+	if !verifier.Database.IsMember(account, group) {
+		return nil, fmt.Sprintf("user %q is not a member of group %q", account.Username, group.Name), nil
+	}
+	return group, "", nil
+}
@@ -0,0 +1,141 @@
+package infrastructure
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"wl/plugin/domain"
+)
+
+var testDatabase = AccountDatabase{EtcDir: "testdata"}
+
+func attestationOf(systemInfo domain.SystemInfo) *domain.UserAttestation {
+	return &domain.UserAttestation{UserInfo: domain.UserInfo{Name: "alice", SystemInfo: systemInfo}}
+}
+
+func TestVerifyFillsInNamesAndIDs(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		reported domain.SystemInfo
+	}{
+		{
+			name: "ids only",
+			reported: domain.SystemInfo{
+				UserID:              "1001",
+				GroupID:             "1001",
+				SupplementaryGroups: []domain.GroupInfo{{GroupID: "27"}, {GroupID: "999"}},
+			},
+		},
+		{
+			name: "names only",
+			reported: domain.SystemInfo{
+				Username:            "alice",
+				GroupName:           "alice",
+				SupplementaryGroups: []domain.GroupInfo{{GroupName: "sudo"}, {GroupName: "docker"}},
+			},
+		},
+		{
+			name: "no primary group",
+			reported: domain.SystemInfo{
+				Username:            "alice",
+				SupplementaryGroups: []domain.GroupInfo{{GroupID: "27", GroupName: "sudo"}, {GroupID: "999", GroupName: "docker"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attestation := attestationOf(tc.reported)
+			verified, dropped, err := AccountVerifier{Database: testDatabase}.Verify(attestation)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if len(dropped) > 0 {
+				t.Errorf("expected no dropped group, got %v", dropped)
+			}
+			systemInfo := verified.UserInfo.SystemInfo
+			if systemInfo.UserID != "1001" || systemInfo.Username != "alice" || systemInfo.GroupID != "1001" || systemInfo.GroupName != "alice" {
+				t.Errorf("expected alice to be resolved, got %+v", systemInfo)
+			}
+			expected := []domain.GroupInfo{{GroupID: "27", GroupName: "sudo"}, {GroupID: "999", GroupName: "docker"}}
+			if !slices.Equal(systemInfo.SupplementaryGroups, expected) {
+				t.Errorf("expected groups %v, got %v", expected, systemInfo.SupplementaryGroups)
+			}
+			if attestation.UserInfo.SystemInfo.Username != tc.reported.Username {
+				t.Error("expected the reported attestation to be left unchanged")
+			}
+		})
+	}
+}
+
+func TestVerifyDropsForeignGroups(t *testing.T) {
+	attestation := attestationOf(domain.SystemInfo{
+		UserID: "1001",
+		SupplementaryGroups: []domain.GroupInfo{
+			{GroupID: "27", GroupName: "sudo"},
+			{GroupID: "1500", GroupName: "contractors"},
+			{GroupID: "4000"},
+			{GroupID: "999", GroupName: "sudo"},
+			{GroupID: "0", GroupName: "root", InnerGroupID: "0"},
+		},
+	})
+
+	verified, dropped, err := AccountVerifier{Database: testDatabase}.Verify(attestation)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if groups := verified.UserInfo.SystemInfo.SupplementaryGroups; !slices.Equal(groups, []domain.GroupInfo{{GroupID: "27", GroupName: "sudo"}}) {
+		t.Errorf("expected only sudo to be kept, got %v", groups)
+	}
+	expected := []string{
+		`user "alice" is not a member of group "contractors"`,
+		`group 4000/"" does not exist`,
+		`gid 999 belongs to "docker", module reported "sudo"`,
+		`user "alice" is not a member of group "root"`,
+	}
+	if !slices.Equal(dropped, expected) {
+		t.Errorf("expected dropped groups %q, got %q", expected, dropped)
+	}
+}
+
+func TestVerifyKeepsInnerGroupIDs(t *testing.T) {
+	attestation := attestationOf(domain.SystemInfo{
+		UserID:              "1001",
+		SupplementaryGroups: []domain.GroupInfo{{GroupID: "27", InnerGroupID: "10"}},
+	})
+
+	verified, _, err := AccountVerifier{Database: testDatabase}.Verify(attestation)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if groups := verified.UserInfo.SystemInfo.SupplementaryGroups; !slices.Equal(groups, []domain.GroupInfo{{GroupID: "27", GroupName: "sudo", InnerGroupID: "10"}}) {
+		t.Errorf("expected the inner group id to be kept, got %v", groups)
+	}
+}
+
+func TestVerifyRejectsMismatchingAccounts(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		reported domain.SystemInfo
+	}{
+		{name: "neither id nor username", reported: domain.SystemInfo{GroupID: "1001"}},
+		{name: "unknown uid", reported: domain.SystemInfo{UserID: "4000"}},
+		{name: "unknown username", reported: domain.SystemInfo{Username: "mallory"}},
+		{name: "uid of another user", reported: domain.SystemInfo{UserID: "1002", Username: "alice"}},
+		{name: "foreign primary group", reported: domain.SystemInfo{UserID: "1001", GroupID: "1002"}},
+		{name: "primary group name mismatch", reported: domain.SystemInfo{UserID: "1001", GroupID: "1001", GroupName: "bob"}},
+		{name: "unknown primary group", reported: domain.SystemInfo{UserID: "1001", GroupName: "staff"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := AccountVerifier{Database: testDatabase}.Verify(attestationOf(tc.reported))
+			if !errors.Is(err, ErrAccountMismatch) {
+				t.Fatalf("expected an account mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyMissingDatabase(t *testing.T) {
+	_, _, err := AccountVerifier{Database: AccountDatabase{EtcDir: "testdata/missing"}}.Verify(attestationOf(domain.SystemInfo{UserID: "1001"}))
+	if err == nil || errors.Is(err, ErrAccountMismatch) {
+		t.Fatalf("expected a read error, got %v", err)
+	}
+}
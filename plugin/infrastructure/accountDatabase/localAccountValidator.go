@@ -0,0 +1,39 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+)
+
+// LocalAccountValidator checks that the user reported by the module exists in
+// the host account database with the same user and primary group IDs.
+type LocalAccountValidator struct {
+	Database AccountDatabase
+	presentation.UserAuthService
+}
+
+func (validator LocalAccountValidator) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
+	systemInfo := data.UserInfo.SystemInfo
+
+	account, err := validator.Database.LookupUser(systemInfo.Username)
+	if errors.Is(err, ErrNotFound) {
+		return domain.UserAttestationValidation{Message: fmt.Sprintf("user %q does not exist", systemInfo.Username)}, nil
+	}
+	if err != nil {
+		return domain.UserAttestationValidation{}, err
+	}
+
+	if account.UserID != systemInfo.UserID {
+		return domain.UserAttestationValidation{
+			Message: fmt.Sprintf("user %q has uid %s, module reported %s", account.Username, account.UserID, systemInfo.UserID),
+		}, nil
+	}
+	if account.GroupID != systemInfo.GroupID {
+		return domain.UserAttestationValidation{
+			Message: fmt.Sprintf("user %q has gid %s, module reported %s", account.Username, account.GroupID, systemInfo.GroupID),
+		}, nil
+	}
+	return domain.UserAttestationValidation{IsValid: true, Message: "local account matches"}, nil
+}
@@ -0,0 +1,180 @@
+package infrastructure
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrUserNotFound = errors.New("user not found in directory")
+
+type LDAPDirectoryOptions struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter is a filter with a single %s that is replaced by the escaped
+	// username, e.g. "(uid=%s)".
+	UserFilter     string
+	GroupAttribute string
+	Attributes     []string
+	StartTLS       bool
+	TLSConfig      *tls.Config
+	Timeout        time.Duration
+	CacheTTL       time.Duration
+}
+
+type cachedUser struct {
+	user      *domain.DirectoryUser
+	err       error
+	expiresAt time.Time
+}
+
+// LDAPDirectoryAdaptor looks users up in an LDAP directory and keeps the
+// answers, including misses, for CacheTTL.
+type LDAPDirectoryAdaptor struct {
+	presentation.UserDirectory
+	options LDAPDirectoryOptions
+
+	mtx       sync.Mutex
+	cache     map[string]cachedUser
+	timeNowFn func() time.Time
+}
+
+func NewLDAPDirectoryAdaptor(options LDAPDirectoryOptions) *LDAPDirectoryAdaptor {
+	return &LDAPDirectoryAdaptor{
+		options:   options,
+		cache:     make(map[string]cachedUser),
+		timeNowFn: time.Now,
+	}
+}
+
+func (adaptor *LDAPDirectoryAdaptor) LookupUser(username string) (*domain.DirectoryUser, error) {
+	if user, err, ok := adaptor.cached(username); ok {
+		return user, err
+	}
+
+	user, err := adaptor.search(username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		// Directory failures are not cached so the next attestation retries.
+		return nil, err
+	}
+
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+	adaptor.cache[username] = cachedUser{user: user, err: err, expiresAt: adaptor.timeNowFn().Add(adaptor.options.CacheTTL)}
+	return user, err
+}
+
+// InvalidateUser drops the cached answer for a user, so the next lookup asks
+// the directory again.
+func (adaptor *LDAPDirectoryAdaptor) InvalidateUser(username string) {
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+	delete(adaptor.cache, username)
+}
+
+func (adaptor *LDAPDirectoryAdaptor) cached(username string) (*domain.DirectoryUser, error, bool) {
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+
+	entry, ok := adaptor.cache[username]
+	if !ok {
+		return nil, nil, false
+	}
+	if !adaptor.timeNowFn().Before(entry.expiresAt) {
+		delete(adaptor.cache, username)
+		return nil, nil, false
+	}
+	return entry.user, entry.err, true
+}
+
+func (adaptor *LDAPDirectoryAdaptor) search(username string) (*domain.DirectoryUser, error) {
+	conn, err := adaptor.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attributes := append([]string{adaptor.options.GroupAttribute}, adaptor.options.Attributes...)
+	request := ldap.NewSearchRequest(
+		adaptor.options.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(adaptor.options.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(adaptor.options.UserFilter, ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("ldap search failed: %w", err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("ldap search for %q returned %d entries", username, len(result.Entries))
+	}
+
+	entry := result.Entries[0]
+	user := &domain.DirectoryUser{
+		DN:         entry.DN,
+		Attributes: make(map[string][]string),
+	}
+	for _, group := range entry.GetAttributeValues(adaptor.options.GroupAttribute) {
+		user.Groups = append(user.Groups, groupName(group))
+	}
+	for _, attribute := range adaptor.options.Attributes {
+		if values := entry.GetAttributeValues(attribute); len(values) > 0 {
+			user.Attributes[attribute] = values
+		}
+	}
+	return user, nil
+}
+
+func (adaptor *LDAPDirectoryAdaptor) connect() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: adaptor.options.Timeout}
+	conn, err := ldap.DialURL(adaptor.options.URL,
+		ldap.DialWithDialer(dialer),
+		ldap.DialWithTLSConfig(adaptor.options.TLSConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+	conn.SetTimeout(adaptor.options.Timeout)
+
+	if adaptor.options.StartTLS {
+		if err := conn.StartTLS(adaptor.options.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %w", err)
+		}
+	}
+	if adaptor.options.BindDN != "" {
+		if err := conn.Bind(adaptor.options.BindDN, adaptor.options.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap bind failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// groupName returns the value of the first RDN when the group is given as a
+// DN, as memberOf does, and the raw value otherwise.
+func groupName(group string) string {
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return group
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
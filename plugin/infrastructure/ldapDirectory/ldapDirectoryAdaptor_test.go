@@ -0,0 +1,230 @@
+package infrastructure
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeLDAPServer is an in-process LDAP stand-in that understands simple binds
+// and searches whose filter matches one of its entries exactly.
+type fakeLDAPServer struct {
+	listener net.Listener
+	bindDN   string
+	password string
+	// entries maps a search filter to the attributes of the returned entry.
+	entries map[string]map[string][]string
+
+	mtx      sync.Mutex
+	searches int
+	delay    time.Duration
+}
+
+func newFakeLDAPServer(t *testing.T) *fakeLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeLDAPServer{
+		listener: listener,
+		bindDN:   "cn=attestor,dc=example,dc=com",
+		password: "secret",
+		entries: map[string]map[string][]string{
+			"(uid=alice)": {
+				"memberOf":   {"cn=platform,ou=groups,dc=example,dc=com", "cn=oncall,ou=groups,dc=example,dc=com"},
+				"department": {"engineering"},
+			},
+		},
+	}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (server *fakeLDAPServer) url() string {
+	return "ldap://" + server.listener.Addr().String()
+}
+
+func (server *fakeLDAPServer) searchCount() int {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	return server.searches
+}
+
+func (server *fakeLDAPServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handle(conn)
+	}
+}
+
+func (server *fakeLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			code := ldap.LDAPResultSuccess
+			if request.Children[1].Value.(string) != server.bindDN || request.Children[2].Data.String() != server.password {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(envelope(messageID, result(ldap.ApplicationBindResponse, code)).Bytes())
+		case ldap.ApplicationSearchRequest:
+			server.mtx.Lock()
+			server.searches++
+			delay := server.delay
+			server.mtx.Unlock()
+			time.Sleep(delay)
+
+			filter, _ := ldap.DecompileFilter(request.Children[6])
+			if attributes, ok := server.entries[filter]; ok {
+				conn.Write(envelope(messageID, entry("uid=alice,ou=people,dc=example,dc=com", attributes)).Bytes())
+			}
+			conn.Write(envelope(messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func envelope(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.NewSequence("LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return packet
+}
+
+func entry(dn string, attributes map[string][]string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "objectName"))
+	list := ber.NewSequence("attributes")
+	for name, values := range attributes {
+		attribute := ber.NewSequence("attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	packet.AppendChild(list)
+	return packet
+}
+
+func newTestAdaptor(server *fakeLDAPServer) *LDAPDirectoryAdaptor {
+	return NewLDAPDirectoryAdaptor(LDAPDirectoryOptions{
+		URL:            server.url(),
+		BindDN:         server.bindDN,
+		BindPassword:   server.password,
+		BaseDN:         "ou=people,dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		Attributes:     []string{"department"},
+		Timeout:        time.Second,
+		CacheTTL:       time.Minute,
+	})
+}
+
+func TestLookupUser(t *testing.T) {
+	server := newFakeLDAPServer(t)
+	adaptor := newTestAdaptor(server)
+
+	user, err := adaptor.LookupUser("alice")
+	if err != nil {
+		t.Fatalf("LookupUser failed: %v", err)
+	}
+	if !slices.Equal(user.Groups, []string{"platform", "oncall"}) {
+		t.Errorf("unexpected groups %v", user.Groups)
+	}
+	if !slices.Equal(user.Attributes["department"], []string{"engineering"}) {
+		t.Errorf("unexpected attributes %v", user.Attributes)
+	}
+}
+
+func TestLookupUserNotFound(t *testing.T) {
+	server := newFakeLDAPServer(t)
+	adaptor := newTestAdaptor(server)
+
+	if _, err := adaptor.LookupUser("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestLookupUserEscapesFilter(t *testing.T) {
+	server := newFakeLDAPServer(t)
+	adaptor := newTestAdaptor(server)
+
+	if _, err := adaptor.LookupUser("*"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestLookupUserCachesResults(t *testing.T) {
+	server := newFakeLDAPServer(t)
+	adaptor := newTestAdaptor(server)
+	now := time.Now()
+	adaptor.timeNowFn = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := adaptor.LookupUser("alice"); err != nil {
+			t.Fatalf("LookupUser failed: %v", err)
+		}
+	}
+	if server.searchCount() != 1 {
+		t.Fatalf("expected 1 search, got %d", server.searchCount())
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := adaptor.LookupUser("alice"); err != nil {
+		t.Fatalf("LookupUser failed: %v", err)
+	}
+	if server.searchCount() != 2 {
+		t.Fatalf("expected the expired entry to be searched again, got %d searches", server.searchCount())
+	}
+}
+
+func TestLookupUserInvalidCredentials(t *testing.T) {
+	server := newFakeLDAPServer(t)
+	adaptor := newTestAdaptor(server)
+	adaptor.options.BindPassword = "wrong"
+
+	_, err := adaptor.LookupUser("alice")
+	if err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected a bind error, got %v", err)
+	}
+}
+
+func TestLookupUserTimeout(t *testing.T) {
+	server := newFakeLDAPServer(t)
+	server.delay = 500 * time.Millisecond
+	adaptor := newTestAdaptor(server)
+	adaptor.options.Timeout = 100 * time.Millisecond
+
+	if _, err := adaptor.LookupUser("alice"); err == nil {
+		t.Fatal("expected the lookup to time out")
+	}
+}
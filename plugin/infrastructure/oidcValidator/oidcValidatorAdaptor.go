@@ -0,0 +1,161 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+type OIDCValidatorOptions struct {
+	IssuerURL string
+	Audience  string
+	// RequireNonce requires the nonce claim to be the base64url encoding, without
+	// padding, of the nonce the plugin sent to the module.
+	RequireNonce bool
+	// UserClaim, when set, names the claim that must equal the user name
+	// reported by the module.
+	UserClaim string
+	// ClaimSelectors maps claim names to the selector key they are exposed
+	// under, e.g. {"email": "email"} gives "oidc:email:<value>".
+	ClaimSelectors    map[string]string
+	DiscoveryCacheTTL time.Duration
+	HTTPClient        *http.Client
+}
+
+// OIDCValidatorAdaptor validates UserAttestation.Token as an OIDC ID token.
+// The issuer is discovered lazily and rediscovered every DiscoveryCacheTTL;
+// signing keys are fetched again whenever a token uses an unknown key.
+type OIDCValidatorAdaptor struct {
+	presentation.UserAuthService
+	options OIDCValidatorOptions
+
+	mtx          sync.Mutex
+	verifier     *oidc.IDTokenVerifier
+	discoveredAt time.Time
+	timeNowFn    func() time.Time
+}
+
+func NewOIDCValidatorAdaptor(options OIDCValidatorOptions) *OIDCValidatorAdaptor {
+	return &OIDCValidatorAdaptor{
+		options:   options,
+		timeNowFn: time.Now,
+	}
+}
+
+func (adaptor *OIDCValidatorAdaptor) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
+	verifier, err := adaptor.getVerifier()
+	if err != nil {
+		return domain.UserAttestationValidation{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(adaptor.clientContext(), adaptor.options.HTTPClient.Timeout)
+	defer cancel()
+	token, err := verifier.Verify(ctx, data.Token)
+	if err != nil {
+		return domain.UserAttestationValidation{Message: fmt.Sprintf("invalid id token: %v", err)}, nil
+	}
+
+	if adaptor.options.RequireNonce {
+		expected := base64.RawURLEncoding.EncodeToString(data.Nonce)
+		if token.Nonce == "" || token.Nonce != expected {
+			return domain.UserAttestationValidation{Message: "id token nonce does not match the attestation nonce"}, nil
+		}
+	}
+
+	var claims map[string]any
+	if err := token.Claims(&claims); err != nil {
+		return domain.UserAttestationValidation{Message: fmt.Sprintf("invalid id token claims: %v", err)}, nil
+	}
+	if adaptor.options.UserClaim != "" {
+		if user, _ := claims[adaptor.options.UserClaim].(string); user != data.UserInfo.Name {
+			return domain.UserAttestationValidation{
+				Message: fmt.Sprintf("id token claim %q is %q, module reported user %q", adaptor.options.UserClaim, user, data.UserInfo.Name),
+			}, nil
+		}
+	}
+
+	return domain.UserAttestationValidation{
+		IsValid:   true,
+		Message:   fmt.Sprintf("valid id token for subject %q", token.Subject),
+		Selectors: adaptor.claimSelectors(claims),
+		ExpiresAt: token.Expiry,
+	}, nil
+}
+
+func (adaptor *OIDCValidatorAdaptor) getVerifier() (*oidc.IDTokenVerifier, error) {
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+
+	now := adaptor.timeNowFn()
+	if adaptor.verifier != nil && now.Sub(adaptor.discoveredAt) < adaptor.options.DiscoveryCacheTTL {
+		return adaptor.verifier, nil
+	}
+
+	ctx, cancel := context.WithTimeout(adaptor.clientContext(), adaptor.options.HTTPClient.Timeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, adaptor.options.IssuerURL)
+	if err != nil {
+		// Keep using the last discovered configuration while the issuer is
+		// unreachable, and retry on the next attestation.
+		if adaptor.verifier != nil {
+			return adaptor.verifier, nil
+		}
+		return nil, fmt.Errorf("failed to discover oidc issuer: %w", err)
+	}
+
+	adaptor.verifier = provider.VerifierContext(adaptor.clientContext(), &oidc.Config{
+		ClientID: adaptor.options.Audience,
+		Now:      adaptor.timeNowFn,
+	})
+	adaptor.discoveredAt = now
+	return adaptor.verifier, nil
+}
+
+// Close drops the idle keep-alive connections to the issuer.
+func (adaptor *OIDCValidatorAdaptor) Close() error {
+	if adaptor.options.HTTPClient != nil {
+		adaptor.options.HTTPClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (adaptor *OIDCValidatorAdaptor) clientContext() context.Context {
+	return oidc.ClientContext(context.Background(), adaptor.options.HTTPClient)
+}
+
+func (adaptor *OIDCValidatorAdaptor) claimSelectors(claims map[string]any) []string {
+	names := make([]string, 0, len(adaptor.options.ClaimSelectors))
+	for name := range adaptor.options.ClaimSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selectors := []string{}
+	for _, name := range names {
+		prefix := "oidc:" + adaptor.options.ClaimSelectors[name] + ":"
+		switch value := claims[name].(type) {
+		case string:
+			selectors = append(selectors, prefix+value)
+		case []any:
+			for _, item := range value {
+				if s, ok := item.(string); ok {
+					selectors = append(selectors, prefix+s)
+				}
+			}
+		case bool:
+			selectors = append(selectors, prefix+strconv.FormatBool(value))
+		case float64:
+			selectors = append(selectors, prefix+strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	return selectors
+}
@@ -0,0 +1,247 @@
+package infrastructure
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+)
+
+// fakeIssuer is a local OIDC issuer stand-in serving discovery and JWKS
+// documents and minting RS256 ID tokens.
+type fakeIssuer struct {
+	server *httptest.Server
+
+	mtx         sync.Mutex
+	keyID       string
+	key         *rsa.PrivateKey
+	discoveries int
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	issuer := &fakeIssuer{}
+	issuer.rotate(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mtx.Lock()
+		issuer.discoveries++
+		issuer.mtx.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.server.URL,
+			"jwks_uri":                              issuer.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mtx.Lock()
+		defer issuer.mtx.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": issuer.keyID,
+				"n":   base64.RawURLEncoding.EncodeToString(issuer.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(issuer.key.E)).Bytes()),
+			}},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (issuer *fakeIssuer) discoveryCount() int {
+	issuer.mtx.Lock()
+	defer issuer.mtx.Unlock()
+	return issuer.discoveries
+}
+
+func (issuer *fakeIssuer) rotate(t *testing.T, keyID string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.mtx.Lock()
+	defer issuer.mtx.Unlock()
+	issuer.keyID = keyID
+	issuer.key = key
+}
+
+func (issuer *fakeIssuer) mint(t *testing.T, claims map[string]any) string {
+	issuer.mtx.Lock()
+	defer issuer.mtx.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": issuer.keyID})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, issuer.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (issuer *fakeIssuer) claims(nonce []byte) map[string]any {
+	return map[string]any{
+		"iss":    issuer.server.URL,
+		"aud":    "spire-user-attestor",
+		"sub":    "00u1",
+		"email":  "alice@example.com",
+		"groups": []string{"platform", "oncall"},
+		"nonce":  base64.RawURLEncoding.EncodeToString(nonce),
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func newTestAdaptor(issuer *fakeIssuer) *OIDCValidatorAdaptor {
+	return NewOIDCValidatorAdaptor(OIDCValidatorOptions{
+		IssuerURL:         issuer.server.URL,
+		Audience:          "spire-user-attestor",
+		RequireNonce:      true,
+		UserClaim:         "email",
+		ClaimSelectors:    map[string]string{"email": "email", "groups": "group"},
+		DiscoveryCacheTTL: time.Hour,
+		HTTPClient:        &http.Client{Timeout: time.Second},
+	})
+}
+
+func newAttestation(token string, nonce []byte) *domain.UserAttestation {
+	return &domain.UserAttestation{
+		Token:    token,
+		Nonce:    nonce,
+		UserInfo: domain.UserInfo{Name: "alice@example.com"},
+	}
+}
+
+func TestValidateData(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	adaptor := newTestAdaptor(issuer)
+	nonce := []byte("nonce")
+
+	result, err := adaptor.ValidateData(newAttestation(issuer.mint(t, issuer.claims(nonce)), nonce))
+	if err != nil {
+		t.Fatalf("ValidateData failed: %v", err)
+	}
+	if !result.IsValid {
+		t.Fatalf("expected a valid token: %s", result.Message)
+	}
+	expected := []string{"oidc:email:alice@example.com", "oidc:group:platform", "oidc:group:oncall"}
+	if !slices.Equal(result.Selectors, expected) {
+		t.Errorf("expected selectors %v, got %v", expected, result.Selectors)
+	}
+}
+
+func TestValidateDataRejectsInvalidTokens(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	nonce := []byte("nonce")
+
+	for _, tt := range []struct {
+		name    string
+		mutate  func(map[string]any)
+		message string
+	}{
+		{name: "wrong audience", mutate: func(c map[string]any) { c["aud"] = "other" }, message: "audience"},
+		{name: "expired", mutate: func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, message: "expired"},
+		{name: "wrong issuer", mutate: func(c map[string]any) { c["iss"] = "https://evil.example" }, message: "different provider"},
+		{name: "wrong nonce", mutate: func(c map[string]any) { c["nonce"] = "replayed" }, message: "nonce"},
+		{name: "other user", mutate: func(c map[string]any) { c["email"] = "bob@example.com" }, message: "module reported user"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims(nonce)
+			tt.mutate(claims)
+
+			result, err := newTestAdaptor(issuer).ValidateData(newAttestation(issuer.mint(t, claims), nonce))
+			if err != nil {
+				t.Fatalf("ValidateData failed: %v", err)
+			}
+			if result.IsValid {
+				t.Fatal("expected the token to be rejected")
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("expected message to mention %q, got %q", tt.message, result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateDataRejectsForeignSignature(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	other := newFakeIssuer(t)
+	nonce := []byte("nonce")
+
+	claims := issuer.claims(nonce)
+	result, err := newTestAdaptor(issuer).ValidateData(newAttestation(other.mint(t, claims), nonce))
+	if err != nil {
+		t.Fatalf("ValidateData failed: %v", err)
+	}
+	if result.IsValid {
+		t.Fatal("expected a token signed by another key to be rejected")
+	}
+}
+
+func TestValidateDataFollowsKeyRotation(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	adaptor := newTestAdaptor(issuer)
+	nonce := []byte("nonce")
+
+	if result, err := adaptor.ValidateData(newAttestation(issuer.mint(t, issuer.claims(nonce)), nonce)); err != nil || !result.IsValid {
+		t.Fatalf("expected a valid token, got %+v, %v", result, err)
+	}
+
+	issuer.rotate(t, "key-2")
+	if result, err := adaptor.ValidateData(newAttestation(issuer.mint(t, issuer.claims(nonce)), nonce)); err != nil || !result.IsValid {
+		t.Fatalf("expected a token signed by the rotated key to be valid, got %+v, %v", result, err)
+	}
+	if issuer.discoveryCount() != 1 {
+		t.Errorf("expected the discovery document to be cached, got %d discoveries", issuer.discoveryCount())
+	}
+}
+
+func TestValidateDataRediscoversAfterCacheTTL(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	adaptor := newTestAdaptor(issuer)
+	now := time.Now()
+	adaptor.timeNowFn = func() time.Time { return now }
+	nonce := []byte("nonce")
+
+	for i := 0; i < 2; i++ {
+		claims := issuer.claims(nonce)
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(time.Hour).Unix()
+		if result, err := adaptor.ValidateData(newAttestation(issuer.mint(t, claims), nonce)); err != nil || !result.IsValid {
+			t.Fatalf("expected a valid token, got %+v, %v", result, err)
+		}
+		now = now.Add(2 * time.Hour)
+	}
+	if issuer.discoveryCount() != 2 {
+		t.Errorf("expected 2 discoveries, got %d", issuer.discoveryCount())
+	}
+}
+
+func TestValidateDataIssuerUnavailable(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	adaptor := newTestAdaptor(issuer)
+	issuer.server.Close()
+
+	if _, err := adaptor.ValidateData(newAttestation("token", nil)); err == nil {
+		t.Fatal("expected an error when the issuer cannot be discovered")
+	}
+}
@@ -0,0 +1,206 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+
+	"github.com/google/cel-go/cel"
+	"github.com/hashicorp/hcl"
+)
+
+type RuleEffect string
+
+const (
+	EffectDeny            RuleEffect = "deny"
+	EffectAddSelectors    RuleEffect = "add_selectors"
+	EffectRemoveSelectors RuleEffect = "remove_selectors"
+)
+
+// RuleConfig is a single rule of a policy file:
+//
+//	rule "deny-system-users" {
+//	  condition = "user.uid != '' && int(user.uid) < 1000"
+//	  effect    = "deny"
+//	  message   = "system users cannot be attested"
+//	}
+type RuleConfig struct {
+	Name      string   `hcl:",key"`
+	Condition string   `hcl:"condition"`
+	Effect    string   `hcl:"effect"`
+	Message   string   `hcl:"message"`
+	Selectors []string `hcl:"selectors"`
+}
+
+type policyFile struct {
+	Rules []RuleConfig `hcl:"rule"`
+}
+
+type compiledRule struct {
+	RuleConfig
+	source  string
+	program cel.Program
+}
+
+// CELPolicyEngine evaluates the rules of its policy files, in order, against
+// the user attestation, the attested process and the validation result.
+type CELPolicyEngine struct {
+	presentation.PolicyEngine
+	rules []compiledRule
+}
+
+func LoadCELPolicyEngine(paths []string) (*CELPolicyEngine, error) {
+	engine := &CELPolicyEngine{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy file: %w", err)
+		}
+		if err := engine.compile(path, string(content)); err != nil {
+			return nil, err
+		}
+	}
+	return engine, nil
+}
+
+func newCELEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("process", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("validation", cel.MapType(cel.StringType, cel.DynType)),
+	)
+}
+
+func (engine *CELPolicyEngine) compile(source string, content string) error {
+	var file policyFile
+	if err := hcl.Decode(&file, content); err != nil {
+		return fmt.Errorf("failed to decode policy file %s: %w", source, err)
+	}
+
+	env, err := newCELEnv()
+	if err != nil {
+		return err
+	}
+	for _, rule := range file.Rules {
+		switch RuleEffect(rule.Effect) {
+		case EffectDeny:
+		case EffectAddSelectors, EffectRemoveSelectors:
+			if len(rule.Selectors) == 0 {
+				return fmt.Errorf("%s: rule %q: selectors are required for effect %q", source, rule.Name, rule.Effect)
+			}
+		default:
+			return fmt.Errorf("%s: rule %q: unknown effect %q", source, rule.Name, rule.Effect)
+		}
+
+		ast, issues := env.Compile(rule.Condition)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("%s: rule %q: %w", source, rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return fmt.Errorf("%s: rule %q: condition must evaluate to a bool, got %s", source, rule.Name, ast.OutputType())
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return fmt.Errorf("%s: rule %q: %w", source, rule.Name, err)
+		}
+		engine.rules = append(engine.rules, compiledRule{RuleConfig: rule, source: source, program: program})
+	}
+	return nil
+}
+
+func (engine *CELPolicyEngine) Evaluate(input domain.PolicyInput) (domain.PolicyDecision, error) {
+	return engine.evaluate(newActivation(input))
+}
+
+func (engine *CELPolicyEngine) evaluate(activation map[string]any) (domain.PolicyDecision, error) {
+	decision := domain.PolicyDecision{Allowed: true}
+	for _, rule := range engine.rules {
+		out, _, err := rule.program.Eval(activation)
+		if err != nil {
+			return domain.PolicyDecision{}, fmt.Errorf("%s: rule %q: %w", rule.source, rule.Name, err)
+		}
+		matched, ok := out.Value().(bool)
+		if !ok {
+			return domain.PolicyDecision{}, fmt.Errorf("%s: rule %q: condition returned %v instead of a bool", rule.source, rule.Name, out.Type())
+		}
+		if !matched {
+			continue
+		}
+
+		switch RuleEffect(rule.Effect) {
+		case EffectDeny:
+			// The first matching deny rule decides, later rules do not run.
+			decision.Allowed = false
+			decision.DeniedBy = rule.Name
+			decision.Message = rule.Message
+			decision.AddSelectors = nil
+			decision.RemoveSelectors = nil
+			return decision, nil
+		case EffectAddSelectors:
+			decision.AddSelectors = append(decision.AddSelectors, rule.Selectors...)
+		case EffectRemoveSelectors:
+			decision.RemoveSelectors = append(decision.RemoveSelectors, rule.Selectors...)
+		}
+	}
+	return decision, nil
+}
+
+func newActivation(input domain.PolicyInput) map[string]any {
+	userInfo := input.Attestation.UserInfo
+	groups := []any{}
+	groupIDs := []any{}
+	for _, group := range userInfo.SystemInfo.SupplementaryGroups {
+		groups = append(groups, group.GroupName)
+		groupIDs = append(groupIDs, group.GroupID)
+	}
+	modules := []any{}
+	for _, source := range input.Attestation.Sources {
+		modules = append(modules, source.Module)
+	}
+
+	steps := []any{}
+	for _, step := range input.Validation.Steps {
+		steps = append(steps, map[string]any{
+			"name":    step.Name,
+			"mode":    step.Mode,
+			"valid":   step.IsValid,
+			"message": step.Message,
+		})
+	}
+
+	return map[string]any{
+		"user": map[string]any{
+			"name":      userInfo.Name,
+			"username":  userInfo.SystemInfo.Username,
+			"uid":       userInfo.SystemInfo.UserID,
+			"gid":       userInfo.SystemInfo.GroupID,
+			"group":     userInfo.SystemInfo.GroupName,
+			"groups":    groups,
+			"group_ids": groupIDs,
+			"modules":   modules,
+		},
+		"process": map[string]any{
+			"pid":     int64(input.Process.Pid),
+			"name":    input.Process.Name,
+			"exe":     input.Process.Exe,
+			"cmdline": toList(input.Process.Cmdline),
+			"uids":    toList(input.Process.UIDs),
+			"gids":    toList(input.Process.GIDs),
+		},
+		"validation": map[string]any{
+			"valid":    input.Validation.IsValid,
+			"degraded": input.Validation.Degraded,
+			"message":  input.Validation.Message,
+			"steps":    steps,
+		},
+	}
+}
+
+func toList(values []string) []any {
+	list := make([]any, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	return list
+}
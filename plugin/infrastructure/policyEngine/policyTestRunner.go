@@ -0,0 +1,161 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"wl/plugin/domain"
+)
+
+// PolicyTestCase is one entry of a JSON policy test file. Input holds the
+// "user", "process" and "validation" variables as rules see them, and goes
+// through the same conversion as a real attestation.
+type PolicyTestCase struct {
+	Name   string                `json:"name"`
+	Input  PolicyTestInput       `json:"input"`
+	Expect PolicyTestExpectation `json:"expect"`
+}
+
+// PolicyTestInput mirrors the variables of the rules. Fields left out get
+// the value of an attestation without them.
+type PolicyTestInput struct {
+	User struct {
+		Name     string   `json:"name"`
+		Username string   `json:"username"`
+		UID      string   `json:"uid"`
+		GID      string   `json:"gid"`
+		Group    string   `json:"group"`
+		Groups   []string `json:"groups"`
+		GroupIDs []string `json:"group_ids"`
+		Modules  []string `json:"modules"`
+	} `json:"user"`
+	Process struct {
+		Pid     int32    `json:"pid"`
+		Name    string   `json:"name"`
+		Exe     string   `json:"exe"`
+		Cmdline []string `json:"cmdline"`
+		UIDs    []string `json:"uids"`
+		GIDs    []string `json:"gids"`
+	} `json:"process"`
+	Validation struct {
+		Valid    bool   `json:"valid"`
+		Degraded bool   `json:"degraded"`
+		Message  string `json:"message"`
+		Steps    []struct {
+			Name    string `json:"name"`
+			Mode    string `json:"mode"`
+			Valid   bool   `json:"valid"`
+			Message string `json:"message"`
+		} `json:"steps"`
+	} `json:"validation"`
+}
+
+type PolicyTestExpectation struct {
+	Allow           *bool    `json:"allow"`
+	DeniedBy        string   `json:"denied_by"`
+	AddSelectors    []string `json:"add_selectors"`
+	RemoveSelectors []string `json:"remove_selectors"`
+}
+
+type PolicyTestResult struct {
+	Name    string
+	Passed  bool
+	Failure string
+}
+
+func RunPolicyTests(engine *CELPolicyEngine, path string) ([]PolicyTestResult, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy test file: %w", err)
+	}
+
+	// Unknown variables are rejected, rules would not see them.
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var cases []PolicyTestCase
+	if err := decoder.Decode(&cases); err != nil {
+		return nil, fmt.Errorf("failed to decode policy test file %s: %w", path, err)
+	}
+
+	results := make([]PolicyTestResult, len(cases))
+	for i, testCase := range cases {
+		results[i] = PolicyTestResult{Name: testCase.Name}
+		if testCase.Expect.Allow == nil {
+			return nil, fmt.Errorf("%s: test %q: expect.allow is required", path, testCase.Name)
+		}
+
+		decision, err := engine.Evaluate(testCase.Input.policyInput())
+		if err != nil {
+			results[i].Failure = err.Error()
+			continue
+		}
+		results[i].Failure = compareDecision(testCase.Expect, decision.Allowed, decision.DeniedBy, decision.AddSelectors, decision.RemoveSelectors)
+		results[i].Passed = results[i].Failure == ""
+	}
+	return results, nil
+}
+
+func compareDecision(expect PolicyTestExpectation, allowed bool, deniedBy string, added []string, removed []string) string {
+	switch {
+	case *expect.Allow != allowed:
+		return fmt.Sprintf("expected allow=%t, got allow=%t (denied by %q)", *expect.Allow, allowed, deniedBy)
+	case expect.DeniedBy != "" && expect.DeniedBy != deniedBy:
+		return fmt.Sprintf("expected denial by %q, got %q", expect.DeniedBy, deniedBy)
+	case expect.AddSelectors != nil && !slices.Equal(expect.AddSelectors, added):
+		return fmt.Sprintf("expected added selectors %v, got %v", expect.AddSelectors, added)
+	case expect.RemoveSelectors != nil && !slices.Equal(expect.RemoveSelectors, removed):
+		return fmt.Sprintf("expected removed selectors %v, got %v", expect.RemoveSelectors, removed)
+	}
+	return ""
+}
+
+func (input PolicyTestInput) policyInput() domain.PolicyInput {
+	user := input.User
+	groups := make([]domain.GroupInfo, max(len(user.Groups), len(user.GroupIDs)))
+	for i, name := range user.Groups {
+		groups[i].GroupName = name
+	}
+	for i, id := range user.GroupIDs {
+		groups[i].GroupID = id
+	}
+	sources := make([]domain.AttestationSource, len(user.Modules))
+	for i, module := range user.Modules {
+		sources[i].Module = module
+	}
+	steps := make([]domain.ValidationStep, len(input.Validation.Steps))
+	for i, step := range input.Validation.Steps {
+		steps[i] = domain.ValidationStep{Name: step.Name, Mode: step.Mode, IsValid: step.Valid, Message: step.Message}
+	}
+
+	return domain.PolicyInput{
+		Attestation: domain.UserAttestation{
+			UserInfo: domain.UserInfo{
+				Name: user.Name,
+				SystemInfo: domain.SystemInfo{
+					UserID:              user.UID,
+					Username:            user.Username,
+					GroupID:             user.GID,
+					GroupName:           user.Group,
+					SupplementaryGroups: groups,
+				},
+			},
+			Sources: sources,
+		},
+		Process: domain.ProcessInfo{
+			Pid:     input.Process.Pid,
+			Name:    input.Process.Name,
+			Exe:     input.Process.Exe,
+			Cmdline: input.Process.Cmdline,
+			UIDs:    input.Process.UIDs,
+			GIDs:    input.Process.GIDs,
+		},
+		Validation: domain.UserAttestationValidation{
+			IsValid:  input.Validation.Valid,
+			Degraded: input.Validation.Degraded,
+			Message:  input.Validation.Message,
+			Steps:    steps,
+		},
+	}
+}
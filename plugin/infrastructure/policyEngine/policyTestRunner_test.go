@@ -0,0 +1,92 @@
+package infrastructure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const examplesDir = "../../../examples/policy"
+
+func TestExamplePolicies(t *testing.T) {
+	engine, err := LoadCELPolicyEngine([]string{filepath.Join(examplesDir, "attestation.hcl")})
+	if err != nil {
+		t.Fatalf("LoadCELPolicyEngine failed: %v", err)
+	}
+	results, err := RunPolicyTests(engine, filepath.Join(examplesDir, "attestation_test.json"))
+	if err != nil {
+		t.Fatalf("RunPolicyTests failed: %v", err)
+	}
+	if len(results) == 0 {
+		t.Fatal("expected the example to have tests")
+	}
+	for _, result := range results {
+		if !result.Passed {
+			t.Errorf("%s: %s", result.Name, result.Failure)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRunPolicyTestsUsesAttestationVariables(t *testing.T) {
+	engine, err := LoadCELPolicyEngine([]string{writeFile(t, "policy.hcl", `
+rule "deny-unvalidated-sudo" {
+  condition = "'27' in user.group_ids && !validation.steps.exists(s, s.name == 'auth_service' && s.valid)"
+  effect    = "deny"
+}
+rule "tag-pid" {
+  condition = "process.pid > 0 && size(process.uids) == 4"
+  effect    = "add_selectors"
+  selectors = ["policy:process"]
+}
+`)})
+	if err != nil {
+		t.Fatalf("LoadCELPolicyEngine failed: %v", err)
+	}
+
+	results, err := RunPolicyTests(engine, writeFile(t, "policy_test.json", `[
+  {
+    "name": "sudo without the auth service is denied",
+    "input": {"user": {"groups": ["sudo"], "group_ids": ["27"]}},
+    "expect": {"allow": false, "denied_by": "deny-unvalidated-sudo"}
+  },
+  {
+    "name": "sudo validated by the auth service is allowed",
+    "input": {
+      "user": {"groups": ["sudo"], "group_ids": ["27"]},
+      "process": {"pid": 4242, "uids": ["0", "0", "0", "0"]},
+      "validation": {"steps": [{"name": "auth_service", "mode": "required", "valid": true}]}
+    },
+    "expect": {"allow": true, "add_selectors": ["policy:process"]}
+  }
+]`))
+	if err != nil {
+		t.Fatalf("RunPolicyTests failed: %v", err)
+	}
+	for _, result := range results {
+		if !result.Passed {
+			t.Errorf("%s: %s", result.Name, result.Failure)
+		}
+	}
+}
+
+func TestRunPolicyTestsRejectsUnknownVariables(t *testing.T) {
+	engine, err := LoadCELPolicyEngine([]string{filepath.Join(examplesDir, "attestation.hcl")})
+	if err != nil {
+		t.Fatalf("LoadCELPolicyEngine failed: %v", err)
+	}
+	_, err = RunPolicyTests(engine, writeFile(t, "policy_test.json", `[
+  {"name": "typo", "input": {"user": {"gruops": ["sudo"]}}, "expect": {"allow": true}}
+]`))
+	if err == nil {
+		t.Fatal("expected an error for an unknown variable")
+	}
+}
@@ -0,0 +1,101 @@
+package infrastructure
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type CgroupEntry struct {
+	HierarchyID string
+	Controllers []string
+	Path        string
+}
+
+type ContainerInfo struct {
+	ID      string
+	Runtime string
+}
+
+// containerPatterns recognize the cgroup path segments container runtimes
+// create, capturing the 64 hexadecimal characters long container ID.
+var containerPatterns = []struct {
+	runtime string
+	pattern *regexp.Regexp
+}{
+	{runtime: "containerd", pattern: regexp.MustCompile(`cri-containerd-([0-9a-f]{64})\.scope`)},
+	{runtime: "cri-o", pattern: regexp.MustCompile(`crio-(?:conmon-)?([0-9a-f]{64})(?:\.scope)?`)},
+	{runtime: "podman", pattern: regexp.MustCompile(`libpod-(?:conmon-)?([0-9a-f]{64})(?:\.scope)?`)},
+	{runtime: "docker", pattern: regexp.MustCompile(`docker-([0-9a-f]{64})\.scope`)},
+	{runtime: "docker", pattern: regexp.MustCompile(`/docker/([0-9a-f]{64})(?:/|$)`)},
+	{runtime: "kubernetes", pattern: regexp.MustCompile(`/kubepods.*/(?:pod[^/]+)/([0-9a-f]{64})(?:/|$)`)},
+}
+
+// Cgroups returns the entries of /proc/<pid>/cgroup.
+func (fs ProcFS) Cgroups(pid int32) ([]CgroupEntry, error) {
+	f, err := os.Open(fs.path(pid, "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []CgroupEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		entry := CgroupEntry{HierarchyID: fields[0], Path: fields[2]}
+		if fields[1] != "" {
+			entry.Controllers = strings.Split(fields[1], ",")
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fs.path(pid, "cgroup"), err)
+	}
+	return entries, nil
+}
+
+// CgroupPath returns the cgroup v2 path of the process, or the path of the
+// first v1 hierarchy on hosts without a unified hierarchy.
+func CgroupPath(entries []CgroupEntry) string {
+	for _, entry := range entries {
+		if entry.HierarchyID == "0" && len(entry.Controllers) == 0 {
+			return entry.Path
+		}
+	}
+	if len(entries) > 0 {
+		return entries[0].Path
+	}
+	return ""
+}
+
+// DetectContainer returns the container the cgroups belong to, if any.
+func DetectContainer(entries []CgroupEntry) (*ContainerInfo, bool) {
+	for _, entry := range entries {
+		for _, candidate := range containerPatterns {
+			if match := candidate.pattern.FindStringSubmatch(entry.Path); match != nil {
+				return &ContainerInfo{ID: match[1], Runtime: candidate.runtime}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Namespace returns the inode number identifying the given namespace of the
+// process, e.g. "4026531836" for a link to "pid:[4026531836]".
+func (fs ProcFS) Namespace(pid int32, name string) (string, error) {
+	link, err := os.Readlink(fs.path(pid, "ns", name))
+	if err != nil {
+		return "", err
+	}
+	inode, ok := strings.CutPrefix(link, name+":[")
+	if !ok || !strings.HasSuffix(inode, "]") {
+		return "", fmt.Errorf("unexpected namespace link %q", link)
+	}
+	return strings.TrimSuffix(inode, "]"), nil
+}
@@ -0,0 +1,89 @@
+package infrastructure
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const containerID = "3f4b6c2a9d8e7f1a0b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a"
+
+func TestDetectContainer(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		path    string
+		runtime string
+	}{
+		{name: "containerd", path: "/system.slice/containerd.service/kubepods-burstable.slice:cri-containerd:" + containerID + "/cri-containerd-" + containerID + ".scope", runtime: "containerd"},
+		{name: "cri-o", path: "/kubepods.slice/kubepods-pod1.slice/crio-" + containerID + ".scope", runtime: "cri-o"},
+		{name: "cri-o conmon", path: "/machine.slice/crio-conmon-" + containerID, runtime: "cri-o"},
+		{name: "podman", path: "/user.slice/user-1001.slice/user@1001.service/user.slice/libpod-" + containerID + ".scope", runtime: "podman"},
+		{name: "docker systemd", path: "/system.slice/docker-" + containerID + ".scope", runtime: "docker"},
+		{name: "docker cgroupfs", path: "/docker/" + containerID, runtime: "docker"},
+		{name: "kubernetes cgroupfs", path: "/kubepods/besteffort/pod0d3a2b1c/" + containerID, runtime: "kubernetes"},
+		{name: "login session", path: "/user.slice/user-1001.slice/session-7.scope"},
+		{name: "short id", path: "/docker/3f4b6c2a9d8e"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			container, ok := DetectContainer([]CgroupEntry{{HierarchyID: "0", Path: tc.path}})
+			if tc.runtime == "" {
+				if ok {
+					t.Fatalf("expected no container, got %+v", container)
+				}
+				return
+			}
+			if !ok || container.ID != containerID || container.Runtime != tc.runtime {
+				t.Fatalf("expected a %s container %s, got %+v", tc.runtime, containerID, container)
+			}
+		})
+	}
+}
+
+func TestCgroupPath(t *testing.T) {
+	v1 := CgroupEntry{HierarchyID: "4", Controllers: []string{"cpu", "cpuacct"}, Path: "/v1"}
+	v2 := CgroupEntry{HierarchyID: "0", Path: "/v2"}
+
+	if path := CgroupPath([]CgroupEntry{v1, v2}); path != "/v2" {
+		t.Errorf("expected the unified hierarchy, got %q", path)
+	}
+	if path := CgroupPath([]CgroupEntry{v1}); path != "/v1" {
+		t.Errorf("expected the first v1 hierarchy, got %q", path)
+	}
+	if path := CgroupPath(nil); path != "" {
+		t.Errorf("expected no path, got %q", path)
+	}
+}
+
+func TestCgroupsAndNamespace(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "42")
+	if err := os.MkdirAll(filepath.Join(dir, "ns"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cgroup := "12:cpu,cpuacct:/docker/" + containerID + "\n0::/system.slice/docker-" + containerID + ".scope\nmalformed\n"
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, link := range map[string]string{"pid": "pid:[4026532301]", "user": "net:[4026531840]"} {
+		if err := os.Symlink(link, filepath.Join(dir, "ns", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := ProcFS{Root: root}
+
+	entries, err := fs.Cgroups(42)
+	if err != nil {
+		t.Fatalf("Cgroups failed: %v", err)
+	}
+	if len(entries) != 2 || !slices.Equal(entries[0].Controllers, []string{"cpu", "cpuacct"}) || entries[1].Controllers != nil {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	if inode, err := fs.Namespace(42, "pid"); err != nil || inode != "4026532301" {
+		t.Errorf("expected the pid namespace inode, got %q, %v", inode, err)
+	}
+	if _, err := fs.Namespace(42, "user"); err == nil {
+		t.Error("expected an error for a link to another namespace type")
+	}
+}
@@ -0,0 +1,90 @@
+package infrastructure
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type IDMapping struct {
+	Inside  uint64
+	Outside uint64
+	Length  uint64
+}
+
+// IDMap is the content of a uid_map or gid_map file. Outside IDs are relative
+// to the user namespace of the reader, i.e. the host for the agent.
+type IDMap []IDMapping
+
+// UIDMap returns /proc/<pid>/uid_map.
+func (fs ProcFS) UIDMap(pid int32) (IDMap, error) {
+	return fs.readIDMap(pid, "uid_map")
+}
+
+// GIDMap returns /proc/<pid>/gid_map.
+func (fs ProcFS) GIDMap(pid int32) (IDMap, error) {
+	return fs.readIDMap(pid, "gid_map")
+}
+
+func (fs ProcFS) readIDMap(pid int32, name string) (IDMap, error) {
+	f, err := os.Open(fs.path(pid, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idMap := IDMap{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed line %q in %s", scanner.Text(), fs.path(pid, name))
+		}
+		var values [3]uint64
+		for i, field := range fields {
+			if values[i], err = strconv.ParseUint(field, 10, 32); err != nil {
+				return nil, fmt.Errorf("malformed line %q in %s: %w", scanner.Text(), fs.path(pid, name), err)
+			}
+		}
+		idMap = append(idMap, IDMapping{Inside: values[0], Outside: values[1], Length: values[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fs.path(pid, name), err)
+	}
+	return idMap, nil
+}
+
+// IsIdentity reports whether the map is the one of the initial user
+// namespace, where every ID maps to itself.
+func (idMap IDMap) IsIdentity() bool {
+	return len(idMap) == 1 && idMap[0].Inside == 0 && idMap[0].Outside == 0 && idMap[0].Length == 4294967295
+}
+
+// ToHost translates an ID seen inside the namespace to the host ID.
+func (idMap IDMap) ToHost(id string) (string, error) {
+	return idMap.translate(id, func(m IDMapping) (uint64, uint64) { return m.Inside, m.Outside })
+}
+
+// ToInner translates a host ID to the ID seen inside the namespace.
+func (idMap IDMap) ToInner(id string) (string, error) {
+	return idMap.translate(id, func(m IDMapping) (uint64, uint64) { return m.Outside, m.Inside })
+}
+
+func (idMap IDMap) translate(id string, direction func(IDMapping) (uint64, uint64)) (string, error) {
+	value, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid id %q: %w", id, err)
+	}
+	for _, mapping := range idMap {
+		from, to := direction(mapping)
+		if value >= from && value-from < mapping.Length {
+			return strconv.FormatUint(to+value-from, 10), nil
+		}
+	}
+	return "", fmt.Errorf("id %s is not mapped in the user namespace", id)
+}
@@ -0,0 +1,85 @@
+package infrastructure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rootlessMap maps root to the user running the container and the rest of
+// the namespace to its subordinate IDs.
+var rootlessMap = IDMap{{Inside: 0, Outside: 1001, Length: 1}, {Inside: 1, Outside: 100000, Length: 65536}}
+
+func TestIDMapTranslation(t *testing.T) {
+	for _, tc := range []struct {
+		inner string
+		host  string
+	}{
+		{inner: "0", host: "1001"},
+		{inner: "1", host: "100000"},
+		{inner: "1001", host: "101000"},
+		{inner: "65536", host: "165535"},
+	} {
+		if host, err := rootlessMap.ToHost(tc.inner); err != nil || host != tc.host {
+			t.Errorf("expected inner id %s to be host id %s, got %q, %v", tc.inner, tc.host, host, err)
+		}
+		if inner, err := rootlessMap.ToInner(tc.host); err != nil || inner != tc.inner {
+			t.Errorf("expected host id %s to be inner id %s, got %q, %v", tc.host, tc.inner, inner, err)
+		}
+	}
+}
+
+func TestIDMapUnmappedIDs(t *testing.T) {
+	for _, id := range []string{"65537", "-1", "root", "4294967296"} {
+		if host, err := rootlessMap.ToHost(id); err == nil {
+			t.Errorf("expected inner id %q not to be mapped, got %s", id, host)
+		}
+	}
+	for _, id := range []string{"0", "1000", "99999", "165536"} {
+		if inner, err := rootlessMap.ToInner(id); err == nil {
+			t.Errorf("expected host id %q not to be mapped, got %s", id, inner)
+		}
+	}
+}
+
+func TestIDMapIsIdentity(t *testing.T) {
+	if !(IDMap{{Inside: 0, Outside: 0, Length: 4294967295}}).IsIdentity() {
+		t.Error("expected the initial namespace map to be the identity")
+	}
+	if rootlessMap.IsIdentity() {
+		t.Error("expected a rootless map not to be the identity")
+	}
+	if (IDMap{{Inside: 0, Outside: 0, Length: 65536}}).IsIdentity() {
+		t.Error("expected a partial map not to be the identity")
+	}
+}
+
+func TestReadIDMap(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "42")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("uid_map", "         0       1001          1\n         1     100000      65536\n")
+	write("gid_map", "0 1001\n")
+	fs := ProcFS{Root: root}
+
+	uidMap, err := fs.UIDMap(42)
+	if err != nil {
+		t.Fatalf("UIDMap failed: %v", err)
+	}
+	if len(uidMap) != 2 || uidMap[1] != rootlessMap[1] {
+		t.Errorf("unexpected uid map %+v", uidMap)
+	}
+	if _, err := fs.GIDMap(42); err == nil {
+		t.Error("expected an error for a malformed gid map")
+	}
+	if _, err := fs.UIDMap(43); err == nil {
+		t.Error("expected an error for a missing process")
+	}
+}
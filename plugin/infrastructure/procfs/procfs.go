@@ -0,0 +1,90 @@
+package infrastructure
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcFS reads process information from a procfs mounted at Root.
+type ProcFS struct {
+	Root string
+}
+
+// Status returns the key/value lines of /proc/<pid>/status.
+func (fs ProcFS) Status(pid int32) (map[string]string, error) {
+	f, err := os.Open(fs.path(pid, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	status := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		status[key] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fs.path(pid, "status"), err)
+	}
+	return status, nil
+}
+
+// SupplementaryGroups returns the group IDs of the "Groups:" status line.
+func (fs ProcFS) SupplementaryGroups(pid int32) ([]string, error) {
+	status, err := fs.Status(pid)
+	if err != nil {
+		return nil, err
+	}
+	groups, ok := status["Groups"]
+	if !ok {
+		return nil, fmt.Errorf("no Groups line in %s", fs.path(pid, "status"))
+	}
+	return strings.Fields(groups), nil
+}
+
+// unsetAuditID is the value of loginuid and sessionid for processes that do
+// not belong to a login session, such as daemons started at boot.
+const unsetAuditID = "4294967295"
+
+// LoginUID returns the audit login UID of the process, which is kept across
+// sudo and su, and false when the process has none.
+func (fs ProcFS) LoginUID(pid int32) (string, bool, error) {
+	return fs.readAuditID(pid, "loginuid")
+}
+
+// SessionID returns the audit session ID of the process and false when the
+// process has none.
+func (fs ProcFS) SessionID(pid int32) (string, bool, error) {
+	return fs.readAuditID(pid, "sessionid")
+}
+
+func (fs ProcFS) readAuditID(pid int32, name string) (string, bool, error) {
+	content, err := os.ReadFile(fs.path(pid, name))
+	if err != nil {
+		return "", false, err
+	}
+	id := strings.TrimSpace(string(content))
+	if id == "" || id == unsetAuditID {
+		return "", false, nil
+	}
+	return id, true, nil
+}
+
+func (fs ProcFS) path(pid int32, name ...string) string {
+	return filepath.Join(append([]string{fs.root(), strconv.FormatInt(int64(pid), 10)}, name...)...)
+}
+
+func (fs ProcFS) root() string {
+	if fs.Root == "" {
+		return "/proc"
+	}
+	return fs.Root
+}
@@ -0,0 +1,270 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"wl/plugin/presentation"
+)
+
+// ErrStaleRevocationList is returned when the list could not be refreshed
+// for longer than MaxAge, so revoked tokens may be missing from it.
+var ErrStaleRevocationList = errors.New("revocation list is stale")
+
+// ErrRevocationListNotLoaded is returned until the list was loaded once, as
+// an empty list would let revoked tokens through.
+var ErrRevocationListNotLoaded = errors.New("revocation list has not been loaded yet")
+
+type RevocationListOptions struct {
+	// Exactly one of File and URL is set. URL is fetched with GET and
+	// If-None-Match, File is read again on every refresh.
+	File string
+	URL  string
+
+	RefreshInterval time.Duration
+	// MaxAge, when set, fails revocation checks once the list was not
+	// refreshed successfully for that long.
+	MaxAge     time.Duration
+	HTTPClient *http.Client
+	// OnRefresh is called after every refresh attempt, e.g. for logging.
+	OnRefresh func(stats RevocationListStats, err error)
+}
+
+type RevocationListStats struct {
+	// Size is the number of revoked token hashes and IDs.
+	Size int
+	// Age is the time since the list was last refreshed successfully.
+	Age       time.Duration
+	Refreshed bool
+}
+
+// revocationDocument is the format of the list in files and auth service
+// responses.
+type revocationDocument struct {
+	// TokenSHA256 holds the hex encoded SHA-256 of revoked tokens.
+	TokenSHA256 []string `json:"token_sha256"`
+	// JTI holds the jti claims of revoked JWT tokens.
+	JTI []string `json:"jti"`
+}
+
+// RevocationListAdaptor holds the revoked tokens and keeps them up to date in
+// the background until Close is called.
+type RevocationListAdaptor struct {
+	presentation.RevocationList
+	options RevocationListOptions
+
+	mtx         sync.RWMutex
+	hashes      map[string]bool
+	jtis        map[string]bool
+	etag        string
+	refreshedAt time.Time
+	timeNowFn   func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewRevocationListAdaptor(options RevocationListOptions) (*RevocationListAdaptor, error) {
+	if (options.File == "") == (options.URL == "") {
+		return nil, errors.New("exactly one of a file and a url is required")
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &RevocationListAdaptor{
+		options:   options,
+		hashes:    make(map[string]bool),
+		jtis:      make(map[string]bool),
+		timeNowFn: time.Now,
+	}, nil
+}
+
+// Start refreshes the list every RefreshInterval in the background.
+func (adaptor *RevocationListAdaptor) Start() {
+	adaptor.stop = make(chan struct{})
+	adaptor.done = make(chan struct{})
+	go func() {
+		defer close(adaptor.done)
+		ticker := time.NewTicker(adaptor.options.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-adaptor.stop:
+				return
+			case <-ticker.C:
+				adaptor.Refresh()
+			}
+		}
+	}()
+}
+
+// Close stops the background refresh.
+func (adaptor *RevocationListAdaptor) Close() error {
+	if adaptor.stop != nil {
+		close(adaptor.stop)
+		<-adaptor.done
+		adaptor.stop = nil
+	}
+	return nil
+}
+
+// IsRevoked tells whether the token, or the JWT ID it carries, is revoked.
+func (adaptor *RevocationListAdaptor) IsRevoked(token string) (bool, error) {
+	adaptor.mtx.RLock()
+	defer adaptor.mtx.RUnlock()
+
+	if adaptor.refreshedAt.IsZero() {
+		return false, ErrRevocationListNotLoaded
+	}
+	if adaptor.options.MaxAge > 0 && adaptor.timeNowFn().Sub(adaptor.refreshedAt) > adaptor.options.MaxAge {
+		return false, ErrStaleRevocationList
+	}
+	if token == "" {
+		return false, nil
+	}
+	hash := sha256.Sum256([]byte(token))
+	if adaptor.hashes[hex.EncodeToString(hash[:])] {
+		return true, nil
+	}
+	if jti := tokenID(token); jti != "" && adaptor.jtis[jti] {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (adaptor *RevocationListAdaptor) Stats() RevocationListStats {
+	adaptor.mtx.RLock()
+	defer adaptor.mtx.RUnlock()
+	stats := RevocationListStats{
+		Size:      len(adaptor.hashes) + len(adaptor.jtis),
+		Refreshed: !adaptor.refreshedAt.IsZero(),
+	}
+	if stats.Refreshed {
+		stats.Age = adaptor.timeNowFn().Sub(adaptor.refreshedAt)
+	}
+	return stats
+}
+
+// Refresh loads the list again. On failure the previous list is kept.
+func (adaptor *RevocationListAdaptor) Refresh() error {
+	err := adaptor.refresh()
+	if adaptor.options.OnRefresh != nil {
+		adaptor.options.OnRefresh(adaptor.Stats(), err)
+	}
+	return err
+}
+
+func (adaptor *RevocationListAdaptor) refresh() error {
+	var document *revocationDocument
+	var etag string
+	var err error
+	if adaptor.options.File != "" {
+		document, err = adaptor.readFile()
+	} else {
+		document, etag, err = adaptor.fetch()
+	}
+	if err != nil {
+		return err
+	}
+
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+	adaptor.refreshedAt = adaptor.timeNowFn()
+	if document == nil {
+		// Not modified since the last fetch.
+		return nil
+	}
+	adaptor.hashes = make(map[string]bool, len(document.TokenSHA256))
+	for _, hash := range document.TokenSHA256 {
+		adaptor.hashes[strings.ToLower(hash)] = true
+	}
+	adaptor.jtis = make(map[string]bool, len(document.JTI))
+	for _, jti := range document.JTI {
+		adaptor.jtis[jti] = true
+	}
+	adaptor.etag = etag
+	return nil
+}
+
+func (adaptor *RevocationListAdaptor) readFile() (*revocationDocument, error) {
+	content, err := os.ReadFile(adaptor.options.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %w", err)
+	}
+	return parseRevocationDocument(content)
+}
+
+func (adaptor *RevocationListAdaptor) fetch() (*revocationDocument, string, error) {
+	req, err := http.NewRequest(http.MethodGet, adaptor.options.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	adaptor.mtx.RLock()
+	etag := adaptor.etag
+	adaptor.mtx.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := adaptor.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch revocation list: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		io.Copy(io.Discard, res.Body)
+		return nil, etag, nil
+	case res.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, res.Body)
+		return nil, "", fmt.Errorf("failed to fetch revocation list: unexpected status %s", res.Status)
+	}
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch revocation list: %w", err)
+	}
+	document, err := parseRevocationDocument(content)
+	if err != nil {
+		return nil, "", err
+	}
+	return document, res.Header.Get("ETag"), nil
+}
+
+func parseRevocationDocument(content []byte) (*revocationDocument, error) {
+	document := &revocationDocument{}
+	if err := json.Unmarshal(content, document); err != nil {
+		return nil, fmt.Errorf("failed to decode revocation list: %w", err)
+	}
+	return document, nil
+}
+
+// tokenID returns the jti claim of a JWT without verifying it. That is enough
+// to deny a token, as a forged claim can only get a token rejected.
+func tokenID(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		JTI string `json:"jti"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.JTI
+}
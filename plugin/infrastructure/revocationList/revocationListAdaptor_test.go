@@ -0,0 +1,258 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) advance(d time.Duration) {
+	clock.now = clock.now.Add(d)
+}
+
+func newTestAdaptor(t *testing.T, options RevocationListOptions) (*RevocationListAdaptor, *fakeClock) {
+	t.Helper()
+	adaptor, err := NewRevocationListAdaptor(options)
+	if err != nil {
+		t.Fatalf("NewRevocationListAdaptor failed: %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	adaptor.timeNowFn = clock.Now
+	return adaptor, clock
+}
+
+func hashOf(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// jwtWithID is a JWT carrying jti, which is all the list looks at.
+func jwtWithID(jti string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"alice","jti":%q}`, jti)))
+	return "eyJhbGciOiJub25lIn0." + payload + ".c2lnbmF0dXJl"
+}
+
+// revocationServer serves the list with an ETag and records the
+// If-None-Match headers it gets.
+type revocationServer struct {
+	mtx         sync.Mutex
+	body        string
+	etag        string
+	status      int
+	ifNoneMatch []string
+}
+
+func (server *revocationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	server.ifNoneMatch = append(server.ifNoneMatch, r.Header.Get("If-None-Match"))
+	if server.status != 0 {
+		w.WriteHeader(server.status)
+		return
+	}
+	if server.etag != "" && r.Header.Get("If-None-Match") == server.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", server.etag)
+	fmt.Fprint(w, server.body)
+}
+
+func (server *revocationServer) publish(body, etag string) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	server.body, server.etag = body, etag
+}
+
+func (server *revocationServer) fail(status int) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	server.status = status
+}
+
+func requireRevoked(t *testing.T, adaptor *RevocationListAdaptor, token string, expected bool) {
+	t.Helper()
+	revoked, err := adaptor.IsRevoked(token)
+	if err != nil {
+		t.Fatalf("IsRevoked failed: %v", err)
+	}
+	if revoked != expected {
+		t.Fatalf("expected revoked to be %v for %q", expected, token)
+	}
+}
+
+func TestIsRevoked(t *testing.T) {
+	listFile := filepath.Join(t.TempDir(), "revoked.json")
+	content := fmt.Sprintf(`{"token_sha256": [%q], "jti": ["id-1"]}`, strings.ToUpper(hashOf("revoked-token")))
+	if err := os.WriteFile(listFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	adaptor, _ := newTestAdaptor(t, RevocationListOptions{File: listFile})
+	if err := adaptor.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		revoked bool
+	}{
+		{name: "revoked token hash", token: "revoked-token", revoked: true},
+		{name: "revoked jti", token: jwtWithID("id-1"), revoked: true},
+		{name: "other token", token: "valid-token"},
+		{name: "other jti", token: jwtWithID("id-2")},
+		{name: "jti outside a jwt", token: "id-1"},
+		{name: "malformed jwt payload", token: "a.!!!.c"},
+		{name: "no token"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requireRevoked(t, adaptor, tc.token, tc.revoked)
+		})
+	}
+	if stats := adaptor.Stats(); stats.Size != 2 || !stats.Refreshed {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestIsRevokedFailsUntilLoaded(t *testing.T) {
+	server := &revocationServer{}
+	server.fail(http.StatusServiceUnavailable)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	adaptor, _ := newTestAdaptor(t, RevocationListOptions{URL: httpServer.URL})
+	if err := adaptor.Refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if _, err := adaptor.IsRevoked("valid-token"); !errors.Is(err, ErrRevocationListNotLoaded) {
+		t.Fatalf("expected the list not to be loaded, got %v", err)
+	}
+	if stats := adaptor.Stats(); stats.Refreshed {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	server.fail(0)
+	server.publish(`{"token_sha256": []}`, "")
+	if err := adaptor.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	requireRevoked(t, adaptor, "valid-token", false)
+}
+
+func TestRefreshUsesETag(t *testing.T) {
+	server := &revocationServer{}
+	server.publish(fmt.Sprintf(`{"token_sha256": [%q]}`, hashOf("first")), `"v1"`)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	adaptor, _ := newTestAdaptor(t, RevocationListOptions{URL: httpServer.URL})
+	for range 2 {
+		if err := adaptor.Refresh(); err != nil {
+			t.Fatalf("Refresh failed: %v", err)
+		}
+	}
+	// The list is kept when it was not modified.
+	requireRevoked(t, adaptor, "first", true)
+
+	server.publish(fmt.Sprintf(`{"token_sha256": [%q]}`, hashOf("second")), `"v2"`)
+	if err := adaptor.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	requireRevoked(t, adaptor, "first", false)
+	requireRevoked(t, adaptor, "second", true)
+
+	expected := []string{"", `"v1"`, `"v1"`}
+	if fmt.Sprint(server.ifNoneMatch) != fmt.Sprint(expected) {
+		t.Errorf("expected If-None-Match %q, got %q", expected, server.ifNoneMatch)
+	}
+}
+
+func TestRefreshKeepsListOnFailure(t *testing.T) {
+	server := &revocationServer{}
+	server.publish(fmt.Sprintf(`{"token_sha256": [%q]}`, hashOf("revoked-token")), "")
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	adaptor, _ := newTestAdaptor(t, RevocationListOptions{URL: httpServer.URL})
+	if err := adaptor.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	server.publish("not json", "")
+	if err := adaptor.Refresh(); err == nil {
+		t.Fatal("expected a malformed list to fail the refresh")
+	}
+	server.fail(http.StatusInternalServerError)
+	if err := adaptor.Refresh(); err == nil {
+		t.Fatal("expected an error status to fail the refresh")
+	}
+	requireRevoked(t, adaptor, "revoked-token", true)
+}
+
+func TestIsRevokedFailsWhenStale(t *testing.T) {
+	server := &revocationServer{}
+	server.publish(`{"jti": ["id-1"]}`, `"v1"`)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	var refreshErrs []error
+	adaptor, clock := newTestAdaptor(t, RevocationListOptions{
+		URL:       httpServer.URL,
+		MaxAge:    15 * time.Minute,
+		OnRefresh: func(stats RevocationListStats, err error) { refreshErrs = append(refreshErrs, err) },
+	})
+	if err := adaptor.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	server.fail(http.StatusBadGateway)
+	clock.advance(15 * time.Minute)
+	adaptor.Refresh()
+	requireRevoked(t, adaptor, jwtWithID("id-1"), true)
+	if stats := adaptor.Stats(); stats.Age != 15*time.Minute {
+		t.Errorf("expected the list to be 15m old, got %s", stats.Age)
+	}
+
+	clock.advance(time.Second)
+	if _, err := adaptor.IsRevoked(jwtWithID("id-2")); !errors.Is(err, ErrStaleRevocationList) {
+		t.Fatalf("expected a stale list, got %v", err)
+	}
+
+	// A not modified answer counts as a successful refresh.
+	server.fail(0)
+	if err := adaptor.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	requireRevoked(t, adaptor, jwtWithID("id-2"), false)
+	requireRevoked(t, adaptor, jwtWithID("id-1"), true)
+
+	if len(refreshErrs) != 3 || refreshErrs[0] != nil || refreshErrs[1] == nil || refreshErrs[2] != nil {
+		t.Errorf("unexpected refresh results %v", refreshErrs)
+	}
+}
+
+func TestNewRevocationListAdaptorNeedsOneSource(t *testing.T) {
+	for _, options := range []RevocationListOptions{{}, {File: "revoked.json", URL: "https://auth.example/revocations"}} {
+		if _, err := NewRevocationListAdaptor(options); err == nil {
+			t.Errorf("expected %+v to be rejected", options)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package infrastructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+	"wl/plugin/domain"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignedNoncePrefix is prepended to the nonce before the module signs it, so
+// the signature cannot be replayed as an SSH authentication signature.
+const SignedNoncePrefix = "spire-user-attestor-nonce:"
+
+var ErrInvalidCertificate = errors.New("invalid ssh certificate")
+
+// SSHCertificateVerifier checks OpenSSH user certificates against a set of
+// trusted certificate authorities.
+type SSHCertificateVerifier struct {
+	CAKeys    []ssh.PublicKey
+	timeNowFn func() time.Time
+}
+
+func ParseCAKeys(authorizedKeys []string) ([]ssh.PublicKey, error) {
+	keys := []ssh.PublicKey{}
+	for _, line := range authorizedKeys {
+		rest := []byte(line)
+		for len(bytes.TrimSpace(rest)) > 0 {
+			key, _, _, next, err := ssh.ParseAuthorizedKey(rest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse ssh ca key: %w", err)
+			}
+			keys = append(keys, key)
+			rest = next
+		}
+	}
+	return keys, nil
+}
+
+// Verify checks that certificate is a currently valid user certificate
+// issued by one of the CAs for principal, when principal is not empty, and
+// that signature proves possession of the certificate key for nonce.
+func (verifier SSHCertificateVerifier) Verify(certificate string, signature []byte, nonce []byte, principal string) (*domain.SSHIdentity, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a certificate", ErrInvalidCertificate)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%w: not a user certificate", ErrInvalidCertificate)
+	}
+
+	checker := ssh.CertChecker{
+		IsUserAuthority: verifier.isAuthority,
+		Clock:           verifier.now,
+	}
+	// CheckCert accepts certificates without principals for any principal,
+	// which must not match a required one.
+	if principal != "" && len(cert.ValidPrincipals) == 0 {
+		return nil, fmt.Errorf("%w: no principals, %q is required", ErrInvalidCertificate, principal)
+	}
+	// CheckCert also validates the principal, so without a required one any
+	// principal of the certificate is accepted.
+	if principal == "" && len(cert.ValidPrincipals) > 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+	if !checker.IsUserAuthority(cert.SignatureKey) {
+		return nil, fmt.Errorf("%w: not signed by a trusted ca", ErrInvalidCertificate)
+	}
+
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(signature, sig); err != nil {
+		return nil, fmt.Errorf("%w: malformed nonce signature: %v", ErrInvalidCertificate, err)
+	}
+	if err := cert.Key.Verify(append([]byte(SignedNoncePrefix), nonce...), sig); err != nil {
+		return nil, fmt.Errorf("%w: nonce signature does not match the certificate key: %v", ErrInvalidCertificate, err)
+	}
+
+	identity := &domain.SSHIdentity{
+		KeyID:      cert.KeyId,
+		Principals: cert.ValidPrincipals,
+		Extensions: cert.Extensions,
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		identity.ValidBefore = time.Unix(int64(cert.ValidBefore), 0)
+	}
+	return identity, nil
+}
+
+func (verifier SSHCertificateVerifier) isAuthority(key ssh.PublicKey) bool {
+	for _, ca := range verifier.CAKeys {
+		if bytes.Equal(ca.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (verifier SSHCertificateVerifier) now() time.Time {
+	if verifier.timeNowFn != nil {
+		return verifier.timeNowFn()
+	}
+	return time.Now()
+}
@@ -0,0 +1,175 @@
+package infrastructure
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	now   = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	nonce = []byte("nonce")
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// certificate is what a module returns: a certificate for userKey signed by
+// ca, and the signature of the nonce made with signingKey.
+type certificate struct {
+	ca         ssh.Signer
+	userKey    ssh.Signer
+	signingKey ssh.Signer
+	cert       *ssh.Certificate
+	nonce      []byte
+}
+
+func newCertificate(t *testing.T, ca ssh.Signer) *certificate {
+	t.Helper()
+	userKey := newSigner(t)
+	return &certificate{
+		ca:         ca,
+		userKey:    userKey,
+		signingKey: userKey,
+		nonce:      nonce,
+		cert: &ssh.Certificate{
+			Key:             userKey.PublicKey(),
+			CertType:        ssh.UserCert,
+			KeyId:           "alice@laptop",
+			ValidPrincipals: []string{"alice", "admins"},
+			ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+			ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+			Permissions:     ssh.Permissions{Extensions: map[string]string{"permit-pty": ""}},
+		},
+	}
+}
+
+func (c *certificate) encode(t *testing.T) (string, []byte) {
+	t.Helper()
+	if err := c.cert.SignCert(rand.Reader, c.ca); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := c.signingKey.Sign(rand.Reader, append([]byte(SignedNoncePrefix), c.nonce...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ssh.MarshalAuthorizedKey(c.cert)), ssh.Marshal(signature)
+}
+
+func TestVerify(t *testing.T) {
+	ca := newSigner(t)
+	verifier := SSHCertificateVerifier{CAKeys: []ssh.PublicKey{newSigner(t).PublicKey(), ca.PublicKey()}, timeNowFn: func() time.Time { return now }}
+
+	for _, principal := range []string{"", "alice", "admins"} {
+		encoded, signature := newCertificate(t, ca).encode(t)
+		identity, err := verifier.Verify(encoded, signature, nonce, principal)
+		if err != nil {
+			t.Fatalf("Verify failed for principal %q: %v", principal, err)
+		}
+		if identity.KeyID != "alice@laptop" || !slices.Equal(identity.Principals, []string{"alice", "admins"}) ||
+			!identity.ValidBefore.Equal(now.Add(time.Hour)) || identity.Extensions["permit-pty"] != "" {
+			t.Errorf("unexpected identity %+v", identity)
+		}
+	}
+}
+
+func TestVerifyWithoutExpiry(t *testing.T) {
+	ca := newSigner(t)
+	verifier := SSHCertificateVerifier{CAKeys: []ssh.PublicKey{ca.PublicKey()}, timeNowFn: func() time.Time { return now }}
+
+	c := newCertificate(t, ca)
+	c.cert.ValidBefore = ssh.CertTimeInfinity
+	encoded, signature := c.encode(t)
+	identity, err := verifier.Verify(encoded, signature, nonce, "alice")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !identity.ValidBefore.IsZero() {
+		t.Errorf("expected no expiry, got %s", identity.ValidBefore)
+	}
+}
+
+func TestVerifyRejectsInvalidCertificates(t *testing.T) {
+	ca := newSigner(t)
+	verifier := SSHCertificateVerifier{CAKeys: []ssh.PublicKey{ca.PublicKey()}, timeNowFn: func() time.Time { return now }}
+
+	for _, tc := range []struct {
+		name      string
+		change    func(c *certificate)
+		principal string
+	}{
+		{name: "expired", change: func(c *certificate) { c.cert.ValidBefore = uint64(now.Add(-time.Minute).Unix()) }},
+		{name: "not yet valid", change: func(c *certificate) { c.cert.ValidAfter = uint64(now.Add(time.Minute).Unix()) }},
+		{name: "wrong ca", change: func(c *certificate) { c.ca = newSigner(t) }},
+		{name: "wrong principal", principal: "root"},
+		{name: "no principal when one is required", change: func(c *certificate) { c.cert.ValidPrincipals = nil }, principal: "alice"},
+		{name: "host certificate", change: func(c *certificate) { c.cert.CertType = ssh.HostCert }},
+		{name: "nonce signed by another key", change: func(c *certificate) { c.signingKey = newSigner(t) }},
+		{name: "signature of another nonce", change: func(c *certificate) { c.nonce = []byte("replayed") }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCertificate(t, ca)
+			if tc.change != nil {
+				tc.change(c)
+			}
+			encoded, signature := c.encode(t)
+			if _, err := verifier.Verify(encoded, signature, nonce, tc.principal); !errors.Is(err, ErrInvalidCertificate) {
+				t.Fatalf("expected an invalid certificate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMalformedInput(t *testing.T) {
+	ca := newSigner(t)
+	verifier := SSHCertificateVerifier{CAKeys: []ssh.PublicKey{ca.PublicKey()}, timeNowFn: func() time.Time { return now }}
+	encoded, signature := newCertificate(t, ca).encode(t)
+
+	for _, tc := range []struct {
+		name        string
+		certificate string
+		signature   []byte
+	}{
+		{name: "not a key", certificate: "garbage", signature: signature},
+		{name: "plain key", certificate: string(ssh.MarshalAuthorizedKey(newSigner(t).PublicKey())), signature: signature},
+		{name: "malformed signature", certificate: encoded, signature: []byte("garbage")},
+		{name: "no signature", certificate: encoded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := verifier.Verify(tc.certificate, tc.signature, nonce, ""); !errors.Is(err, ErrInvalidCertificate) {
+				t.Fatalf("expected an invalid certificate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseCAKeys(t *testing.T) {
+	first := string(ssh.MarshalAuthorizedKey(newSigner(t).PublicKey()))
+	second := string(ssh.MarshalAuthorizedKey(newSigner(t).PublicKey()))
+
+	keys, err := ParseCAKeys([]string{first + second, "", first})
+	if err != nil {
+		t.Fatalf("ParseCAKeys failed: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Errorf("expected 3 keys, got %d", len(keys))
+	}
+	if _, err := ParseCAKeys([]string{"ssh-ed25519 garbage"}); err == nil {
+		t.Error("expected an error for a malformed key")
+	}
+}
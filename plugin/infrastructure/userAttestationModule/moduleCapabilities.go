@@ -0,0 +1,150 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"wl/plugin/domain"
+
+	pb "wl/plugin/infrastructure/userAttestationModule/proto/user_attestor"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolVersions are the protocol versions the plugin speaks. Version 1 is
+// the original protocol, version 2 adds capabilities, the optional features
+// and the AttestUser RPC.
+var ProtocolVersions = []uint32{1, 2}
+
+// ErrIncompatibleModule is returned when the plugin and the module have no
+// protocol version in common or the module is older than the minimum version.
+var ErrIncompatibleModule = errors.New("incompatible user attestation module")
+
+var featureNames = map[pb.Feature]domain.ModuleFeature{
+	pb.Feature_FEATURE_NONCE:       domain.FeatureNonce,
+	pb.Feature_FEATURE_SIGNATURES:  domain.FeatureSignatures,
+	pb.Feature_FEATURE_PID_BINDING: domain.FeaturePIDBinding,
+	pb.Feature_FEATURE_STREAMING:   domain.FeatureStreaming,
+}
+
+// Negotiate returns what the plugin and the module agreed on, asking the
+// module when that is not known yet.
+func (adaptor *UserAttestorModuleAdaptor) Negotiate() (domain.ModuleCapabilities, error) {
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+	if adaptor.capabilities != nil {
+		return *adaptor.capabilities, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := adaptor.client.GetCapabilities(ctx, &pb.CapabilitiesRequest{ProtocolVersions: ProtocolVersions})
+	if status.Code(err) == codes.Unimplemented {
+		// Modules predating capabilities speak the first protocol version only.
+		res, err = &pb.Capabilities{ProtocolVersions: []uint32{1}}, nil
+	}
+	if err != nil {
+		return domain.ModuleCapabilities{}, fmt.Errorf("could not get module capabilities: %w", err)
+	}
+
+	capabilities, err := adaptor.negotiate(res)
+	if err != nil {
+		return domain.ModuleCapabilities{}, err
+	}
+	adaptor.capabilities = &capabilities
+	return capabilities, nil
+}
+
+func (adaptor *UserAttestorModuleAdaptor) negotiate(res *pb.Capabilities) (domain.ModuleCapabilities, error) {
+	capabilities := domain.ModuleCapabilities{
+		Name:    res.ModuleName,
+		Version: res.ModuleVersion,
+	}
+	for _, version := range res.ProtocolVersions {
+		if slices.Contains(ProtocolVersions, version) && version > capabilities.ProtocolVersion {
+			capabilities.ProtocolVersion = version
+		}
+	}
+	if capabilities.ProtocolVersion == 0 {
+		return domain.ModuleCapabilities{}, fmt.Errorf("%w: module speaks protocol versions %v, plugin speaks %v", ErrIncompatibleModule, res.ProtocolVersions, ProtocolVersions)
+	}
+
+	if adaptor.options.MinVersion != "" {
+		if capabilities.Version == "" {
+			return domain.ModuleCapabilities{}, fmt.Errorf("%w: module does not report its version, %s or later is required", ErrIncompatibleModule, adaptor.options.MinVersion)
+		}
+		older, err := isOlder(capabilities.Version, adaptor.options.MinVersion)
+		if err != nil {
+			return domain.ModuleCapabilities{}, fmt.Errorf("%w: %v", ErrIncompatibleModule, err)
+		}
+		if older {
+			return domain.ModuleCapabilities{}, fmt.Errorf("%w: module version %s is older than %s", ErrIncompatibleModule, capabilities.Version, adaptor.options.MinVersion)
+		}
+	}
+
+	// Features only exist from the second protocol version on.
+	if capabilities.ProtocolVersion >= 2 {
+		for _, feature := range res.Features {
+			if name, ok := featureNames[feature]; ok && !capabilities.Supports(name) {
+				capabilities.Features = append(capabilities.Features, name)
+			}
+		}
+	}
+	return capabilities, nil
+}
+
+func (adaptor *UserAttestorModuleAdaptor) forgetCapabilities() {
+	adaptor.mtx.Lock()
+	defer adaptor.mtx.Unlock()
+	adaptor.capabilities = nil
+}
+
+// ParseVersion parses a version such as "1.4.2" or "v1.4.2-rc.1" into its
+// numeric components. Pre-release and build suffixes are ignored.
+func ParseVersion(version string) ([]int, error) {
+	trimmed := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+func isOlder(version string, minVersion string) (bool, error) {
+	parsed, err := ParseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	parsedMin, err := ParseVersion(minVersion)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < max(len(parsed), len(parsedMin)); i++ {
+		var part, minPart int
+		if i < len(parsed) {
+			part = parsed[i]
+		}
+		if i < len(parsedMin) {
+			minPart = parsedMin[i]
+		}
+		if part != minPart {
+			return part < minPart, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,169 @@
+package infrastructure
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"wl/plugin/domain"
+	pb "wl/plugin/infrastructure/userAttestationModule/proto/user_attestor"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version  string
+		expected []int
+	}{
+		{version: "1", expected: []int{1}},
+		{version: "1.4.2", expected: []int{1, 4, 2}},
+		{version: "v1.4.2", expected: []int{1, 4, 2}},
+		{version: "v1.4.2-rc.1", expected: []int{1, 4, 2}},
+		{version: "2.0+build.7", expected: []int{2, 0}},
+		{version: "0.10.0", expected: []int{0, 10, 0}},
+	} {
+		parsed, err := ParseVersion(tc.version)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) failed: %v", tc.version, err)
+			continue
+		}
+		if !slices.Equal(parsed, tc.expected) {
+			t.Errorf("ParseVersion(%q): expected %v, got %v", tc.version, tc.expected, parsed)
+		}
+	}
+
+	for _, version := range []string{"", "v", "1.x", "1..2", "1.-2", "-1", "latest"} {
+		if _, err := ParseVersion(version); err == nil {
+			t.Errorf("expected ParseVersion(%q) to fail", version)
+		}
+	}
+}
+
+func TestIsOlder(t *testing.T) {
+	for _, tc := range []struct {
+		version    string
+		minVersion string
+		older      bool
+	}{
+		{version: "1.4.2", minVersion: "1.4.2"},
+		{version: "1.4.3", minVersion: "1.4.2"},
+		{version: "1.10", minVersion: "1.9"},
+		{version: "2", minVersion: "1.9.9"},
+		{version: "1.4", minVersion: "1.4.0"},
+		{version: "v1.4.2-rc.1", minVersion: "1.4.2"},
+		{version: "1.4.1", minVersion: "1.4.2", older: true},
+		{version: "1.9", minVersion: "1.10", older: true},
+		{version: "1.4", minVersion: "1.4.1", older: true},
+		{version: "0.9.9", minVersion: "1", older: true},
+	} {
+		older, err := isOlder(tc.version, tc.minVersion)
+		if err != nil {
+			t.Errorf("isOlder(%q, %q) failed: %v", tc.version, tc.minVersion, err)
+			continue
+		}
+		if older != tc.older {
+			t.Errorf("isOlder(%q, %q): expected %v, got %v", tc.version, tc.minVersion, tc.older, older)
+		}
+	}
+
+	if _, err := isOlder("dev", "1.0"); err == nil {
+		t.Error("expected an error for an unparsable version")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		capabilities *pb.Capabilities
+		minVersion   string
+		expected     domain.ModuleCapabilities
+		incompatible bool
+	}{
+		{
+			name:     "module without capabilities",
+			expected: domain.ModuleCapabilities{ProtocolVersion: 1},
+		},
+		{
+			name: "highest common protocol version",
+			capabilities: &pb.Capabilities{
+				ModuleName:       "laptop",
+				ModuleVersion:    "1.4.2",
+				ProtocolVersions: []uint32{1, 2, 7},
+				Features:         []pb.Feature{pb.Feature_FEATURE_NONCE, pb.Feature_FEATURE_NONCE, pb.Feature_FEATURE_SIGNATURES},
+			},
+			expected: domain.ModuleCapabilities{
+				Name:            "laptop",
+				Version:         "1.4.2",
+				ProtocolVersion: 2,
+				Features:        []domain.ModuleFeature{domain.FeatureNonce, domain.FeatureSignatures},
+			},
+		},
+		{
+			name:         "features need protocol version 2",
+			capabilities: &pb.Capabilities{ProtocolVersions: []uint32{1}, Features: []pb.Feature{pb.Feature_FEATURE_NONCE}},
+			expected:     domain.ModuleCapabilities{ProtocolVersion: 1},
+		},
+		{
+			name:         "no common protocol version",
+			capabilities: &pb.Capabilities{ProtocolVersions: []uint32{7}},
+			incompatible: true,
+		},
+		{
+			name:         "module at the minimum version",
+			capabilities: &pb.Capabilities{ModuleVersion: "v1.4.2", ProtocolVersions: []uint32{2}},
+			minVersion:   "1.4.2",
+			expected:     domain.ModuleCapabilities{Version: "v1.4.2", ProtocolVersion: 2},
+		},
+		{
+			name:         "module older than the minimum version",
+			capabilities: &pb.Capabilities{ModuleVersion: "1.3.9", ProtocolVersions: []uint32{2}},
+			minVersion:   "1.4",
+			incompatible: true,
+		},
+		{
+			name:         "module without a version",
+			capabilities: &pb.Capabilities{ProtocolVersions: []uint32{2}},
+			minVersion:   "1.4",
+			incompatible: true,
+		},
+		{
+			name:         "module without capabilities and a minimum version",
+			minVersion:   "1.4",
+			incompatible: true,
+		},
+		{
+			name:         "module with an unparsable version",
+			capabilities: &pb.Capabilities{ModuleVersion: "dev", ProtocolVersions: []uint32{2}},
+			minVersion:   "1.4",
+			incompatible: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			module := &testModule{capabilities: tc.capabilities}
+			adaptor := serveModule(t, module, UserAttestorModuleOptions{MinVersion: tc.minVersion})
+
+			capabilities, err := adaptor.Negotiate()
+			if tc.incompatible {
+				if !errors.Is(err, ErrIncompatibleModule) {
+					t.Fatalf("expected an incompatible module, got %v", err)
+				}
+				if _, err := adaptor.GetUserAttestationData(4242, nil); !errors.Is(err, ErrIncompatibleModule) {
+					t.Errorf("expected attestations to fail, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Negotiate failed: %v", err)
+			}
+			if capabilities.Name != tc.expected.Name || capabilities.Version != tc.expected.Version ||
+				capabilities.ProtocolVersion != tc.expected.ProtocolVersion || !slices.Equal(capabilities.Features, tc.expected.Features) {
+				t.Errorf("expected %+v, got %+v", tc.expected, capabilities)
+			}
+		})
+	}
+}
+
+func TestNewAdaptorRejectsInvalidMinVersion(t *testing.T) {
+	_, err := NewUserAttestorModuleAdaptor(UserAttestorModuleOptions{Transport: TransportUnix, Address: "module.sock", MinVersion: "latest"})
+	if err == nil {
+		t.Fatal("expected an invalid minimum version to be rejected")
+	}
+}
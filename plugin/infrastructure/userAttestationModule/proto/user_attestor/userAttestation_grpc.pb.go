@@ -1,4 +1,8 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v3.14.0
+// source: proto/userAttestation.proto
 
 package user_attestor
 
@@ -11,14 +15,34 @@ import (
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the grpc package it is being compiled against.
-// Requires gRPC-Go v1.32.0 or later.
-const _ = grpc.SupportPackageIsVersion7
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AttestationService_GetUserAttestation_FullMethodName = "/user_attestor.AttestationService/GetUserAttestation"
+	AttestationService_AttestUser_FullMethodName         = "/user_attestor.AttestationService/AttestUser"
+	AttestationService_GetCapabilities_FullMethodName    = "/user_attestor.AttestationService/GetCapabilities"
+	AttestationService_WatchSessionEvents_FullMethodName = "/user_attestor.AttestationService/WatchSessionEvents"
+)
 
 // AttestationServiceClient is the client API for AttestationService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Define the service
 type AttestationServiceClient interface {
+	// Attestation of protocol version 1 modules, which know nothing about the
+	// request.
 	GetUserAttestation(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*UserAttestation, error)
+	// Attestation of protocol version 2 modules, used instead of
+	// GetUserAttestation once the module reported its capabilities.
+	AttestUser(ctx context.Context, in *AttestationRequest, opts ...grpc.CallOption) (*UserAttestation, error)
+	// Modules without this RPC are treated as protocol version 1 modules
+	// without any optional feature.
+	GetCapabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*Capabilities, error)
+	// Streams the session events of the host users for as long as the plugin
+	// is connected. Only used with modules supporting FEATURE_STREAMING.
+	WatchSessionEvents(ctx context.Context, in *SessionEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SessionEvent], error)
 }
 
 type attestationServiceClient struct {
@@ -30,30 +54,96 @@ func NewAttestationServiceClient(cc grpc.ClientConnInterface) AttestationService
 }
 
 func (c *attestationServiceClient) GetUserAttestation(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*UserAttestation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserAttestation)
+	err := c.cc.Invoke(ctx, AttestationService_GetUserAttestation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *attestationServiceClient) AttestUser(ctx context.Context, in *AttestationRequest, opts ...grpc.CallOption) (*UserAttestation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(UserAttestation)
-	err := c.cc.Invoke(ctx, "/user_attestor.AttestationService/GetUserAttestation", in, out, opts...)
+	err := c.cc.Invoke(ctx, AttestationService_AttestUser_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
+func (c *attestationServiceClient) GetCapabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*Capabilities, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Capabilities)
+	err := c.cc.Invoke(ctx, AttestationService_GetCapabilities_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *attestationServiceClient) WatchSessionEvents(ctx context.Context, in *SessionEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SessionEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AttestationService_ServiceDesc.Streams[0], AttestationService_WatchSessionEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SessionEventsRequest, SessionEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AttestationService_WatchSessionEventsClient = grpc.ServerStreamingClient[SessionEvent]
+
 // AttestationServiceServer is the server API for AttestationService service.
 // All implementations must embed UnimplementedAttestationServiceServer
-// for forward compatibility
+// for forward compatibility.
+//
+// Define the service
 type AttestationServiceServer interface {
+	// Attestation of protocol version 1 modules, which know nothing about the
+	// request.
 	GetUserAttestation(context.Context, *Empty) (*UserAttestation, error)
+	// Attestation of protocol version 2 modules, used instead of
+	// GetUserAttestation once the module reported its capabilities.
+	AttestUser(context.Context, *AttestationRequest) (*UserAttestation, error)
+	// Modules without this RPC are treated as protocol version 1 modules
+	// without any optional feature.
+	GetCapabilities(context.Context, *CapabilitiesRequest) (*Capabilities, error)
+	// Streams the session events of the host users for as long as the plugin
+	// is connected. Only used with modules supporting FEATURE_STREAMING.
+	WatchSessionEvents(*SessionEventsRequest, grpc.ServerStreamingServer[SessionEvent]) error
 	mustEmbedUnimplementedAttestationServiceServer()
 }
 
-// UnimplementedAttestationServiceServer must be embedded to have forward compatible implementations.
-type UnimplementedAttestationServiceServer struct {
-}
+// UnimplementedAttestationServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAttestationServiceServer struct{}
 
 func (UnimplementedAttestationServiceServer) GetUserAttestation(context.Context, *Empty) (*UserAttestation, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserAttestation not implemented")
 }
+func (UnimplementedAttestationServiceServer) AttestUser(context.Context, *AttestationRequest) (*UserAttestation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AttestUser not implemented")
+}
+func (UnimplementedAttestationServiceServer) GetCapabilities(context.Context, *CapabilitiesRequest) (*Capabilities, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCapabilities not implemented")
+}
+func (UnimplementedAttestationServiceServer) WatchSessionEvents(*SessionEventsRequest, grpc.ServerStreamingServer[SessionEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSessionEvents not implemented")
+}
 func (UnimplementedAttestationServiceServer) mustEmbedUnimplementedAttestationServiceServer() {}
+func (UnimplementedAttestationServiceServer) testEmbeddedByValue()                            {}
 
 // UnsafeAttestationServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to AttestationServiceServer will
@@ -63,6 +153,13 @@ type UnsafeAttestationServiceServer interface {
 }
 
 func RegisterAttestationServiceServer(s grpc.ServiceRegistrar, srv AttestationServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAttestationServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
 	s.RegisterService(&AttestationService_ServiceDesc, srv)
 }
 
@@ -76,7 +173,7 @@ func _AttestationService_GetUserAttestation_Handler(srv interface{}, ctx context
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/user_attestor.AttestationService/GetUserAttestation",
+		FullMethod: AttestationService_GetUserAttestation_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(AttestationServiceServer).GetUserAttestation(ctx, req.(*Empty))
@@ -84,6 +181,53 @@ func _AttestationService_GetUserAttestation_Handler(srv interface{}, ctx context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AttestationService_AttestUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AttestationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AttestationServiceServer).AttestUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AttestationService_AttestUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AttestationServiceServer).AttestUser(ctx, req.(*AttestationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AttestationService_GetCapabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AttestationServiceServer).GetCapabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AttestationService_GetCapabilities_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AttestationServiceServer).GetCapabilities(ctx, req.(*CapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AttestationService_WatchSessionEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SessionEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AttestationServiceServer).WatchSessionEvents(m, &grpc.GenericServerStream[SessionEventsRequest, SessionEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AttestationService_WatchSessionEventsServer = grpc.ServerStreamingServer[SessionEvent]
+
 // AttestationService_ServiceDesc is the grpc.ServiceDesc for AttestationService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -95,7 +239,21 @@ var AttestationService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetUserAttestation",
 			Handler:    _AttestationService_GetUserAttestation_Handler,
 		},
+		{
+			MethodName: "AttestUser",
+			Handler:    _AttestationService_AttestUser_Handler,
+		},
+		{
+			MethodName: "GetCapabilities",
+			Handler:    _AttestationService_GetCapabilities_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSessionEvents",
+			Handler:       _AttestationService_WatchSessionEvents_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/userAttestation.proto",
 }
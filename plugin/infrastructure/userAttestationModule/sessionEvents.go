@@ -0,0 +1,50 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"wl/plugin/domain"
+
+	pb "wl/plugin/infrastructure/userAttestationModule/proto/user_attestor"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var sessionEventTypes = map[pb.SessionEventType]domain.SessionEventType{
+	pb.SessionEventType_SESSION_EVENT_TYPE_LOGIN:          domain.SessionLogin,
+	pb.SessionEventType_SESSION_EVENT_TYPE_LOGOUT:         domain.SessionLogout,
+	pb.SessionEventType_SESSION_EVENT_TYPE_LOCK:           domain.SessionLock,
+	pb.SessionEventType_SESSION_EVENT_TYPE_UNLOCK:         domain.SessionUnlock,
+	pb.SessionEventType_SESSION_EVENT_TYPE_TOKEN_ROTATION: domain.SessionTokenRotation,
+}
+
+func (adaptor *UserAttestorModuleAdaptor) WatchSessionEvents(ctx context.Context, handle func(domain.SessionEvent)) error {
+	stream, err := adaptor.client.WatchSessionEvents(ctx, &pb.SessionEventsRequest{})
+	if err != nil {
+		return fmt.Errorf("could not watch session events: %w", err)
+	}
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) == codes.Unavailable {
+				adaptor.forgetCapabilities()
+			}
+			return fmt.Errorf("session event stream broken: %w", err)
+		}
+
+		eventType, ok := sessionEventTypes[res.Type]
+		if !ok {
+			// Event types added after this plugin was built are skipped.
+			continue
+		}
+		handle(domain.SessionEvent{
+			Type:      eventType,
+			UserName:  res.UserName,
+			UserID:    res.UserId,
+			SessionID: res.SessionId,
+			Time:      time.Unix(res.Timestamp, 0),
+		})
+	}
+}
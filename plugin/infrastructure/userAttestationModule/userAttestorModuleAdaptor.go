@@ -2,7 +2,9 @@ package infrastructure
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 	"wl/plugin/domain"
 	"wl/plugin/presentation"
@@ -10,54 +12,160 @@ import (
 	pb "wl/plugin/infrastructure/userAttestationModule/proto/user_attestor"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
+const (
+	TransportUnix = "unix"
+	TransportTCP  = "tcp"
+)
+
+type UserAttestorModuleOptions struct {
+	// Transport is TransportUnix, with a socket path as Address, or
+	// TransportTCP, with a host:port Address.
+	Transport string
+	Address   string
+	// MinVersion, when set, is the oldest module version accepted.
+	MinVersion string
+	// OnExchange, when set, is called after every attestation request, e.g.
+	// for debug logging. The response holds the token and the user secret.
+	OnExchange func(req, res proto.Message, err error)
+}
+
+// UserAttestorModuleAdaptor talks to the module over a single connection that
+// is shared by all attestations until Close is called. What the module
+// supports is negotiated on first use and again whenever it was unreachable,
+// since it may have been replaced by another version meanwhile.
 type UserAttestorModuleAdaptor struct {
-	SocketPath string
 	presentation.UserAttestorModule
+	options UserAttestorModuleOptions
+
+	conn   *grpc.ClientConn
+	client pb.AttestationServiceClient
+
+	mtx          sync.Mutex
+	capabilities *domain.ModuleCapabilities
 }
 
-func (adaptor UserAttestorModuleAdaptor) GetUserAttestationData() (*domain.UserAttestation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+// NewUserAttestorModuleAdaptor creates the client of a module. The connection
+// is not authenticated, so TCP modules are expected to listen on loopback only.
+func NewUserAttestorModuleAdaptor(options UserAttestorModuleOptions) (*UserAttestorModuleAdaptor, error) {
+	var target string
+	switch options.Transport {
+	case TransportUnix:
+		target = "unix://" + options.Address
+	case TransportTCP:
+		target = "dns:///" + options.Address
+	default:
+		return nil, fmt.Errorf("unknown transport %q", options.Transport)
+	}
+	if options.MinVersion != "" {
+		if _, err := ParseVersion(options.MinVersion); err != nil {
+			return nil, fmt.Errorf("invalid minimum version: %w", err)
+		}
+	}
 
 	conn, err := grpc.NewClient(
-		"unix://"+adaptor.SocketPath,
+		target,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
 	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+		return nil, fmt.Errorf("failed to create module client: %w", err)
 	}
-	defer conn.Close()
+	return &UserAttestorModuleAdaptor{
+		options: options,
+		conn:    conn,
+		client:  pb.NewAttestationServiceClient(conn),
+	}, nil
+}
 
-	client := pb.NewAttestationServiceClient(conn)
+func (adaptor *UserAttestorModuleAdaptor) GetUserAttestationData(pid int32, nonce []byte) (*domain.UserAttestation, error) {
+	capabilities, err := adaptor.Negotiate()
+	if err != nil {
+		return nil, err
+	}
 
-	res, err := client.GetUserAttestation(ctx, &pb.Empty{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Modules of the first protocol version only implement the original RPC,
+	// which carries no request.
+	var req proto.Message
+	var res *pb.UserAttestation
+	if capabilities.ProtocolVersion >= 2 {
+		attestationReq := &pb.AttestationRequest{}
+		if capabilities.Supports(domain.FeatureNonce) {
+			attestationReq.Nonce = nonce
+		}
+		if capabilities.Supports(domain.FeaturePIDBinding) {
+			attestationReq.Pid = pid
+		}
+		req = attestationReq
+		res, err = adaptor.client.AttestUser(ctx, attestationReq)
+	} else {
+		emptyReq := &pb.Empty{}
+		req = emptyReq
+		res, err = adaptor.client.GetUserAttestation(ctx, emptyReq)
+	}
+	if adaptor.options.OnExchange != nil {
+		adaptor.options.OnExchange(req, res, err)
+	}
+	if status.Code(err) == codes.Unavailable {
+		adaptor.forgetCapabilities()
+	}
 	if err != nil {
-		log.Fatalf("Could not get attestation: %v", err)
+		return nil, fmt.Errorf("could not get attestation: %w", err)
+	}
+
+	return attestationFromProto(res)
+}
+
+// attestationFromProto converts a module response, rejecting responses
+// without the user information every attestation needs.
+func attestationFromProto(res *pb.UserAttestation) (*domain.UserAttestation, error) {
+	if res.GetUserInfo() == nil {
+		return nil, errors.New("malformed module response: missing user_info")
 	}
+	if res.GetUserInfo().GetSystemInfo() == nil {
+		return nil, errors.New("malformed module response: missing user_info.system_info")
+	}
+	userInfo := res.GetUserInfo()
+	systemInfo := userInfo.GetSystemInfo()
 
-	supplementaryGroups := make([]domain.GroupInfo, len(res.UserInfo.SystemInfo.SupplementaryGroups))
-	for i, group := range res.UserInfo.SystemInfo.SupplementaryGroups {
+	supplementaryGroups := make([]domain.GroupInfo, len(systemInfo.GetSupplementaryGroups()))
+	for i, group := range systemInfo.GetSupplementaryGroups() {
 		supplementaryGroups[i] = domain.GroupInfo{
-			GroupID:   group.GroupId,
-			GroupName: group.GroupName,
+			GroupID:   group.GetGroupId(),
+			GroupName: group.GetGroupName(),
 		}
 	}
 
-	return &domain.UserAttestation{
-		Token: res.Token,
+	attestation := &domain.UserAttestation{
+		Token:          res.GetToken(),
+		SSHCertificate: res.GetSshCertificate(),
+		SSHSignature:   res.GetSshSignature(),
 		UserInfo: domain.UserInfo{
-			Name:   res.UserInfo.Name,
-			Secret: res.UserInfo.Secret,
+			Name:   userInfo.GetName(),
+			Secret: userInfo.GetSecret(),
 			SystemInfo: domain.SystemInfo{
-				UserID:              res.UserInfo.SystemInfo.UserId,
-				Username:            res.UserInfo.SystemInfo.Username,
-				GroupID:             res.UserInfo.SystemInfo.GroupId,
-				GroupName:           res.UserInfo.SystemInfo.GroupName,
+				UserID:              systemInfo.GetUserId(),
+				Username:            systemInfo.GetUsername(),
+				GroupID:             systemInfo.GetGroupId(),
+				GroupName:           systemInfo.GetGroupName(),
 				SupplementaryGroups: supplementaryGroups,
 			},
 		},
-	}, nil
+	}
+	if res.GetTokenExpiresAt() > 0 {
+		attestation.TokenExpiresAt = time.Unix(res.GetTokenExpiresAt(), 0)
+	}
+	return attestation, nil
+}
+
+// Close closes the connection to the module, failing any call still using it.
+func (adaptor *UserAttestorModuleAdaptor) Close() error {
+	return adaptor.conn.Close()
 }
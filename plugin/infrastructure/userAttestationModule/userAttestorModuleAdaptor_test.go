@@ -0,0 +1,172 @@
+package infrastructure
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	pb "wl/plugin/infrastructure/userAttestationModule/proto/user_attestor"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// testModule is a module answering with alice, that reports capabilities
+// when set and records the attestation requests it gets.
+type testModule struct {
+	pb.UnimplementedAttestationServiceServer
+	capabilities *pb.Capabilities
+
+	mtx      sync.Mutex
+	requests []proto.Message
+}
+
+func (module *testModule) GetUserAttestation(ctx context.Context, req *pb.Empty) (*pb.UserAttestation, error) {
+	return module.attest(req)
+}
+
+func (module *testModule) AttestUser(ctx context.Context, req *pb.AttestationRequest) (*pb.UserAttestation, error) {
+	return module.attest(req)
+}
+
+func (module *testModule) GetCapabilities(ctx context.Context, req *pb.CapabilitiesRequest) (*pb.Capabilities, error) {
+	if module.capabilities == nil {
+		return nil, status.Error(codes.Unimplemented, "unknown method GetCapabilities")
+	}
+	return module.capabilities, nil
+}
+
+func (module *testModule) attest(req proto.Message) (*pb.UserAttestation, error) {
+	module.mtx.Lock()
+	defer module.mtx.Unlock()
+	module.requests = append(module.requests, req)
+	return &pb.UserAttestation{
+		Token:    "token",
+		UserInfo: &pb.UserInfo{Name: "alice", SystemInfo: &pb.SystemInfo{UserId: "1001", Username: "alice"}},
+	}, nil
+}
+
+func (module *testModule) lastRequest() proto.Message {
+	module.mtx.Lock()
+	defer module.mtx.Unlock()
+	if len(module.requests) == 0 {
+		return nil
+	}
+	return module.requests[len(module.requests)-1]
+}
+
+// serveModule serves module on a unix socket and returns an adaptor for it.
+func serveModule(t *testing.T, module pb.AttestationServiceServer, options UserAttestorModuleOptions) *UserAttestorModuleAdaptor {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "module.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterAttestationServiceServer(server, module)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	options.Transport = TransportUnix
+	options.Address = socketPath
+	adaptor, err := NewUserAttestorModuleAdaptor(options)
+	if err != nil {
+		t.Fatalf("NewUserAttestorModuleAdaptor failed: %v", err)
+	}
+	t.Cleanup(func() { adaptor.Close() })
+	return adaptor
+}
+
+func TestGetUserAttestationDataByProtocolVersion(t *testing.T) {
+	nonce := []byte("nonce")
+	for _, tc := range []struct {
+		name         string
+		capabilities *pb.Capabilities
+		expected     proto.Message
+	}{
+		{
+			name:     "module without capabilities",
+			expected: &pb.Empty{},
+		},
+		{
+			name:         "protocol version 1",
+			capabilities: &pb.Capabilities{ProtocolVersions: []uint32{1}, Features: []pb.Feature{pb.Feature_FEATURE_NONCE}},
+			expected:     &pb.Empty{},
+		},
+		{
+			name:         "protocol version 2 without features",
+			capabilities: &pb.Capabilities{ProtocolVersions: []uint32{1, 2}},
+			expected:     &pb.AttestationRequest{},
+		},
+		{
+			name: "protocol version 2 with nonce and pid binding",
+			capabilities: &pb.Capabilities{
+				ProtocolVersions: []uint32{2},
+				Features:         []pb.Feature{pb.Feature_FEATURE_NONCE, pb.Feature_FEATURE_PID_BINDING},
+			},
+			expected: &pb.AttestationRequest{Nonce: nonce, Pid: 4242},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			module := &testModule{capabilities: tc.capabilities}
+			var exchanged proto.Message
+			adaptor := serveModule(t, module, UserAttestorModuleOptions{
+				OnExchange: func(req, res proto.Message, err error) { exchanged = req },
+			})
+
+			attestation, err := adaptor.GetUserAttestationData(4242, nonce)
+			if err != nil {
+				t.Fatalf("GetUserAttestationData failed: %v", err)
+			}
+			if attestation.UserInfo.Name != "alice" {
+				t.Errorf("unexpected attestation %+v", attestation)
+			}
+			if req := module.lastRequest(); !proto.Equal(req, tc.expected) || req.ProtoReflect().Descriptor() != tc.expected.ProtoReflect().Descriptor() {
+				t.Errorf("expected request %T %v, got %T %v", tc.expected, tc.expected, req, req)
+			}
+			if !proto.Equal(exchanged, tc.expected) {
+				t.Errorf("expected the exchange of %v, got %v", tc.expected, exchanged)
+			}
+		})
+	}
+}
+
+func FuzzAttestationFromProto(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res := &pb.UserAttestation{}
+		if err := proto.Unmarshal(data, res); err != nil {
+			return
+		}
+
+		attestation, err := attestationFromProto(res)
+		again, againErr := attestationFromProto(res)
+		if (err == nil) != (againErr == nil) || !reflect.DeepEqual(attestation, again) {
+			t.Fatalf("unstable conversion: %+v (%v) then %+v (%v)", attestation, err, again, againErr)
+		}
+		if err != nil {
+			if res.GetUserInfo().GetSystemInfo() != nil {
+				t.Fatalf("rejected a response with user and system info: %v", err)
+			}
+			return
+		}
+
+		systemInfo := res.GetUserInfo().GetSystemInfo()
+		if attestation.Token != res.GetToken() ||
+			attestation.UserInfo.Name != res.GetUserInfo().GetName() ||
+			attestation.UserInfo.SystemInfo.UserID != systemInfo.GetUserId() ||
+			attestation.UserInfo.SystemInfo.Username != systemInfo.GetUsername() {
+			t.Fatalf("conversion lost fields: %+v from %v", attestation, res)
+		}
+		if len(attestation.UserInfo.SystemInfo.SupplementaryGroups) != len(systemInfo.GetSupplementaryGroups()) {
+			t.Fatalf("conversion lost groups: %+v from %v", attestation, res)
+		}
+		if (res.GetTokenExpiresAt() > 0) == attestation.TokenExpiresAt.IsZero() {
+			t.Fatalf("conversion lost the token expiry: %+v from %v", attestation, res)
+		}
+	})
+}
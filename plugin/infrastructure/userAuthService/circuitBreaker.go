@@ -0,0 +1,214 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+)
+
+var ErrCircuitOpen = errors.New("auth service circuit breaker is open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// DefaultMaxGraceEntries bounds the successful validations kept for reuse,
+// one per user and token.
+const DefaultMaxGraceEntries = 10000
+
+type CircuitBreakerOptions struct {
+	FailureThreshold int
+	ResetTimeout     time.Duration
+	AllowGrace       bool
+	GracePeriod      time.Duration
+	// MaxGraceEntries, DefaultMaxGraceEntries when zero, is the number of
+	// validations kept. The oldest one is dropped to make room.
+	MaxGraceEntries int
+}
+
+type lastKnownGood struct {
+	user        string
+	validatedAt time.Time
+	// expiresAt caps the grace period to the lifetime of the token.
+	expiresAt time.Time
+}
+
+// CircuitBreakerAuthService stops calling the wrapped UserAuthService after
+// FailureThreshold consecutive failures and, when AllowGrace is set, reuses a
+// recent successful validation for the same user and token while it is down.
+type CircuitBreakerAuthService struct {
+	service presentation.UserAuthService
+	options CircuitBreakerOptions
+
+	mtx       sync.Mutex
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastGood  map[string]lastKnownGood
+	timeNowFn func() time.Time
+}
+
+func NewCircuitBreakerAuthService(service presentation.UserAuthService, options CircuitBreakerOptions) *CircuitBreakerAuthService {
+	if options.MaxGraceEntries <= 0 {
+		options.MaxGraceEntries = DefaultMaxGraceEntries
+	}
+	return &CircuitBreakerAuthService{
+		service:   service,
+		options:   options,
+		lastGood:  make(map[string]lastKnownGood),
+		timeNowFn: time.Now,
+	}
+}
+
+func (breaker *CircuitBreakerAuthService) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
+	key := graceKey(data)
+
+	if !breaker.allowRequest() {
+		return breaker.fallback(key, ErrCircuitOpen)
+	}
+
+	result, err := breaker.service.ValidateData(data)
+	if err != nil {
+		breaker.recordFailure()
+		return breaker.fallback(key, err)
+	}
+	breaker.recordSuccess(data.UserInfo.Name, key, domain.EarlierExpiry(data.TokenExpiresAt, result.ExpiresAt), result)
+	return result, nil
+}
+
+// Close closes the wrapped service when it holds connections.
+func (breaker *CircuitBreakerAuthService) Close() error {
+	if closer, ok := breaker.service.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (breaker *CircuitBreakerAuthService) allowRequest() bool {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+
+	switch breaker.state {
+	case circuitOpen:
+		if breaker.timeNowFn().Sub(breaker.openedAt) < breaker.options.ResetTimeout {
+			return false
+		}
+		breaker.state = circuitHalfOpen
+		breaker.probing = true
+		return true
+	case circuitHalfOpen:
+		// Only one probe at a time is let through while half-open.
+		if breaker.probing {
+			return false
+		}
+		breaker.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (breaker *CircuitBreakerAuthService) recordFailure() {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+
+	breaker.probing = false
+	breaker.failures++
+	if breaker.state == circuitHalfOpen || breaker.failures >= breaker.options.FailureThreshold {
+		breaker.state = circuitOpen
+		breaker.openedAt = breaker.timeNowFn()
+	}
+}
+
+// InvalidateUser forgets the successful validations of a user, so they are
+// not reused during an outage.
+func (breaker *CircuitBreakerAuthService) InvalidateUser(name string) {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+	for key, entry := range breaker.lastGood {
+		if entry.user == name {
+			delete(breaker.lastGood, key)
+		}
+	}
+}
+
+func (breaker *CircuitBreakerAuthService) recordSuccess(user string, key string, expiresAt time.Time, result domain.UserAttestationValidation) {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+
+	breaker.probing = false
+	breaker.failures = 0
+	breaker.state = circuitClosed
+
+	if !breaker.options.AllowGrace {
+		return
+	}
+	now := breaker.timeNowFn()
+	breaker.pruneLocked(now)
+	if !result.IsValid {
+		delete(breaker.lastGood, key)
+		return
+	}
+	if _, ok := breaker.lastGood[key]; !ok && len(breaker.lastGood) >= breaker.options.MaxGraceEntries {
+		breaker.evictOldestLocked()
+	}
+	breaker.lastGood[key] = lastKnownGood{user: user, validatedAt: now, expiresAt: expiresAt}
+}
+
+// pruneLocked drops the validations that can no longer be reused, so users
+// seen once are not remembered for the lifetime of the agent.
+func (breaker *CircuitBreakerAuthService) pruneLocked(now time.Time) {
+	for key, entry := range breaker.lastGood {
+		if now.Sub(entry.validatedAt) > breaker.options.GracePeriod || (!entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)) {
+			delete(breaker.lastGood, key)
+		}
+	}
+}
+
+func (breaker *CircuitBreakerAuthService) evictOldestLocked() {
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range breaker.lastGood {
+		if oldestKey == "" || entry.validatedAt.Before(oldest) {
+			oldestKey, oldest = key, entry.validatedAt
+		}
+	}
+	delete(breaker.lastGood, oldestKey)
+}
+
+func (breaker *CircuitBreakerAuthService) fallback(key string, cause error) (domain.UserAttestationValidation, error) {
+	if !breaker.options.AllowGrace {
+		return domain.UserAttestationValidation{}, cause
+	}
+
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+
+	breaker.pruneLocked(breaker.timeNowFn())
+	entry, ok := breaker.lastGood[key]
+	if !ok {
+		return domain.UserAttestationValidation{}, cause
+	}
+	return domain.UserAttestationValidation{
+		IsValid:   true,
+		Degraded:  true,
+		Message:   fmt.Sprintf("auth service unavailable (%v), reusing validation from %s", cause, entry.validatedAt.Format(time.RFC3339)),
+		ExpiresAt: entry.expiresAt,
+	}, nil
+}
+
+func graceKey(data *domain.UserAttestation) string {
+	tokenHash := sha256.Sum256([]byte(data.Token))
+	return data.UserInfo.Name + "/" + hex.EncodeToString(tokenHash[:])
+}
@@ -0,0 +1,269 @@
+package infrastructure
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+)
+
+var errServiceDown = errors.New("connection refused")
+
+// fakeAuthService answers with its current result, or err when set, and can
+// hold calls until released.
+type fakeAuthService struct {
+	presentation.UserAuthService
+
+	mtx    sync.Mutex
+	err    error
+	result domain.UserAttestationValidation
+	calls  int
+	hold   chan struct{}
+}
+
+func (service *fakeAuthService) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
+	service.mtx.Lock()
+	service.calls++
+	hold, err, result := service.hold, service.err, service.result
+	service.mtx.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	return result, err
+}
+
+func (service *fakeAuthService) fail(err error) {
+	service.mtx.Lock()
+	defer service.mtx.Unlock()
+	service.err = err
+}
+
+func (service *fakeAuthService) callCount() int {
+	service.mtx.Lock()
+	defer service.mtx.Unlock()
+	return service.calls
+}
+
+type fakeClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) advance(d time.Duration) {
+	clock.mtx.Lock()
+	defer clock.mtx.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+func newTestBreaker(options CircuitBreakerOptions) (*CircuitBreakerAuthService, *fakeAuthService, *fakeClock) {
+	service := &fakeAuthService{result: domain.UserAttestationValidation{IsValid: true, Message: "ok"}}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	breaker := NewCircuitBreakerAuthService(service, options)
+	breaker.timeNowFn = clock.Now
+	return breaker, service, clock
+}
+
+func attestationOf(user, token string) *domain.UserAttestation {
+	return &domain.UserAttestation{Token: token, UserInfo: domain.UserInfo{Name: user}}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	breaker, service, clock := newTestBreaker(CircuitBreakerOptions{FailureThreshold: 2, ResetTimeout: time.Minute})
+	alice := attestationOf("alice", "t")
+
+	// Closed: failures below the threshold still reach the service.
+	service.fail(errServiceDown)
+	for range 2 {
+		if _, err := breaker.ValidateData(alice); !errors.Is(err, errServiceDown) {
+			t.Fatalf("expected the service error while closed, got %v", err)
+		}
+	}
+
+	// Open: calls fail fast without reaching the service.
+	if _, err := breaker.ValidateData(alice); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+	if calls := service.callCount(); calls != 2 {
+		t.Fatalf("expected no call while open, got %d calls", calls)
+	}
+
+	// Half-open: a failed probe opens the circuit again.
+	clock.advance(time.Minute)
+	if _, err := breaker.ValidateData(alice); !errors.Is(err, errServiceDown) {
+		t.Fatalf("expected the probe to reach the service, got %v", err)
+	}
+	if _, err := breaker.ValidateData(alice); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected a failed probe to open the circuit, got %v", err)
+	}
+
+	// Half-open: a successful probe closes it.
+	clock.advance(time.Minute)
+	service.fail(nil)
+	if _, err := breaker.ValidateData(alice); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+
+	// Closed again: a single failure no longer opens it.
+	service.fail(errServiceDown)
+	breaker.ValidateData(alice)
+	service.fail(nil)
+	if _, err := breaker.ValidateData(alice); err != nil {
+		t.Fatalf("expected the circuit to be closed, got %v", err)
+	}
+}
+
+func TestCircuitBreakerSingleHalfOpenProbe(t *testing.T) {
+	breaker, service, clock := newTestBreaker(CircuitBreakerOptions{FailureThreshold: 1, ResetTimeout: time.Minute})
+	alice := attestationOf("alice", "t")
+
+	service.fail(errServiceDown)
+	breaker.ValidateData(alice)
+	clock.advance(time.Minute)
+
+	service.mtx.Lock()
+	service.err = nil
+	service.hold = make(chan struct{})
+	hold := service.hold
+	service.mtx.Unlock()
+
+	probed := make(chan error)
+	go func() {
+		_, err := breaker.ValidateData(alice)
+		probed <- err
+	}()
+	for service.callCount() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := breaker.ValidateData(alice); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected a second call to be refused during the probe, got %v", err)
+	}
+	close(hold)
+	if err := <-probed; err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if calls := service.callCount(); calls != 2 {
+		t.Fatalf("expected a single probe, got %d calls", calls)
+	}
+}
+
+func TestCircuitBreakerGrace(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		expiresAt time.Duration
+		after     time.Duration
+		token     string
+		degraded  bool
+	}{
+		{name: "within grace period", after: 5 * time.Minute, token: "t", degraded: true},
+		{name: "grace period expired", after: 11 * time.Minute, token: "t"},
+		{name: "other token", after: time.Minute, token: "other"},
+		{name: "before token expiry", expiresAt: 3 * time.Minute, after: 2 * time.Minute, token: "t", degraded: true},
+		{name: "capped at token expiry", expiresAt: 3 * time.Minute, after: 4 * time.Minute, token: "t"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			breaker, service, clock := newTestBreaker(CircuitBreakerOptions{
+				FailureThreshold: 1,
+				ResetTimeout:     time.Minute,
+				AllowGrace:       true,
+				GracePeriod:      10 * time.Minute,
+			})
+			if tc.expiresAt > 0 {
+				service.result.ExpiresAt = clock.Now().Add(tc.expiresAt)
+			}
+			if _, err := breaker.ValidateData(attestationOf("alice", "t")); err != nil {
+				t.Fatalf("ValidateData failed: %v", err)
+			}
+
+			service.fail(errServiceDown)
+			clock.advance(tc.after)
+			result, err := breaker.ValidateData(attestationOf("alice", tc.token))
+			if !tc.degraded {
+				if err == nil {
+					t.Fatalf("expected no grace, got %+v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected a degraded validation, got %v", err)
+			}
+			if !result.IsValid || !result.Degraded {
+				t.Fatalf("expected a valid degraded result, got %+v", result)
+			}
+			if tc.expiresAt > 0 && !result.ExpiresAt.Equal(service.result.ExpiresAt) {
+				t.Errorf("expected the token expiry to be kept, got %s", result.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerGraceDisabled(t *testing.T) {
+	breaker, service, _ := newTestBreaker(CircuitBreakerOptions{FailureThreshold: 1, ResetTimeout: time.Minute, GracePeriod: time.Hour})
+	breaker.ValidateData(attestationOf("alice", "t"))
+
+	service.fail(errServiceDown)
+	if _, err := breaker.ValidateData(attestationOf("alice", "t")); !errors.Is(err, errServiceDown) {
+		t.Fatalf("expected no grace unless allowed, got %v", err)
+	}
+}
+
+func TestCircuitBreakerInvalidateUser(t *testing.T) {
+	breaker, service, _ := newTestBreaker(CircuitBreakerOptions{FailureThreshold: 1, ResetTimeout: time.Minute, AllowGrace: true, GracePeriod: time.Hour})
+	breaker.ValidateData(attestationOf("alice", "t"))
+
+	breaker.InvalidateUser("alice")
+	service.fail(errServiceDown)
+	if _, err := breaker.ValidateData(attestationOf("alice", "t")); err == nil {
+		t.Fatal("expected no grace for an invalidated user")
+	}
+}
+
+func TestCircuitBreakerGraceEntriesExpire(t *testing.T) {
+	breaker, service, clock := newTestBreaker(CircuitBreakerOptions{FailureThreshold: 1, ResetTimeout: time.Minute, AllowGrace: true, GracePeriod: 10 * time.Minute})
+	breaker.ValidateData(attestationOf("alice", "t"))
+
+	// Validations of other users drop alice's once it is too old to reuse,
+	// while the auth service is still up.
+	clock.advance(11 * time.Minute)
+	breaker.ValidateData(attestationOf("bob", "t"))
+	if len(breaker.lastGood) != 1 {
+		t.Errorf("expected only bob's validation to be kept, got %v", breaker.lastGood)
+	}
+
+	service.fail(errServiceDown)
+	if _, err := breaker.ValidateData(attestationOf("alice", "t")); !errors.Is(err, errServiceDown) {
+		t.Fatalf("expected the stale validation not to be reused, got %v", err)
+	}
+	if result, err := breaker.ValidateData(attestationOf("bob", "t")); err != nil || !result.Degraded {
+		t.Fatalf("expected bob's validation to be reused, got %+v, %v", result, err)
+	}
+}
+
+func TestCircuitBreakerGraceEntriesAreBounded(t *testing.T) {
+	breaker, service, clock := newTestBreaker(CircuitBreakerOptions{FailureThreshold: 1, ResetTimeout: time.Minute, AllowGrace: true, GracePeriod: time.Hour, MaxGraceEntries: 2})
+	for _, user := range []string{"alice", "bob", "carol"} {
+		breaker.ValidateData(attestationOf(user, "t"))
+		clock.advance(time.Second)
+	}
+	if len(breaker.lastGood) != 2 {
+		t.Fatalf("expected 2 validations to be kept, got %d", len(breaker.lastGood))
+	}
+
+	service.fail(errServiceDown)
+	if _, err := breaker.ValidateData(attestationOf("alice", "t")); err == nil {
+		t.Fatal("expected the oldest validation to be dropped")
+	}
+	for _, user := range []string{"bob", "carol"} {
+		if _, err := breaker.ValidateData(attestationOf(user, "t")); err != nil {
+			t.Errorf("expected the validation of %s to be reused, got %v", user, err)
+		}
+	}
+}
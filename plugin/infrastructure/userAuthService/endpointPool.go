@@ -0,0 +1,180 @@
+package infrastructure
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type LoadBalancingStrategy string
+
+const (
+	LoadBalancingFailover     LoadBalancingStrategy = "failover"
+	LoadBalancingRoundRobin   LoadBalancingStrategy = "round_robin"
+	LoadBalancingLeastLatency LoadBalancingStrategy = "least_latency"
+)
+
+// latencyWeight is the smoothing factor of the per-endpoint latency moving average.
+const latencyWeight = 0.3
+
+type EndpointPoolOptions struct {
+	Strategy LoadBalancingStrategy
+	// ConsecutiveFailures is the number of failures in a row after which an
+	// endpoint is ejected from the pool for EjectionTime.
+	ConsecutiveFailures int
+	EjectionTime        time.Duration
+}
+
+type EndpointHealth struct {
+	URL                 string
+	Healthy             bool
+	ConsecutiveFailures int
+	Latency             time.Duration
+	EjectedUntil        time.Time
+}
+
+type endpoint struct {
+	url                 string
+	priority            int
+	consecutiveFailures int
+	latency             time.Duration
+	ejectedUntil        time.Time
+}
+
+// EndpointPool tracks the health of every configured auth service endpoint and
+// decides in which order they are tried for a request.
+type EndpointPool struct {
+	options EndpointPoolOptions
+
+	mtx       sync.Mutex
+	endpoints []*endpoint
+	next      int
+	timeNowFn func() time.Time
+}
+
+func NewEndpointPool(urls []string, options EndpointPoolOptions) (*EndpointPool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("at least one auth service endpoint is required")
+	}
+	switch options.Strategy {
+	case LoadBalancingFailover, LoadBalancingRoundRobin, LoadBalancingLeastLatency:
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", options.Strategy)
+	}
+
+	endpoints := make([]*endpoint, len(urls))
+	for i, url := range urls {
+		endpoints[i] = &endpoint{url: url, priority: i}
+	}
+	return &EndpointPool{
+		options:   options,
+		endpoints: endpoints,
+		timeNowFn: time.Now,
+	}, nil
+}
+
+// Candidates returns the endpoint URLs in the order they should be tried.
+// Ejected endpoints are only returned, last, when no healthy endpoint is left.
+func (pool *EndpointPool) Candidates() []string {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	now := pool.timeNowFn()
+	healthy := []*endpoint{}
+	ejected := []*endpoint{}
+	for _, e := range pool.endpoints {
+		if now.Before(e.ejectedUntil) {
+			ejected = append(ejected, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+
+	switch pool.options.Strategy {
+	case LoadBalancingRoundRobin:
+		if len(healthy) > 0 {
+			start := pool.next % len(healthy)
+			healthy = append(healthy[start:], healthy[:start]...)
+			pool.next++
+		}
+	case LoadBalancingLeastLatency:
+		// Endpoints without a measurement yet keep a zero latency so they are
+		// tried first and get one. Endpoints whose last call failed come after
+		// the others whatever their latency, as failing fast is not answering.
+		sort.SliceStable(healthy, func(i, j int) bool {
+			iFailing, jFailing := healthy[i].consecutiveFailures > 0, healthy[j].consecutiveFailures > 0
+			if iFailing != jFailing {
+				return jFailing
+			}
+			return healthy[i].latency < healthy[j].latency
+		})
+	}
+	sort.SliceStable(ejected, func(i, j int) bool {
+		return ejected[i].ejectedUntil.Before(ejected[j].ejectedUntil)
+	})
+
+	urls := make([]string, 0, len(pool.endpoints))
+	for _, e := range append(healthy, ejected...) {
+		urls = append(urls, e.url)
+	}
+	return urls
+}
+
+func (pool *EndpointPool) RecordSuccess(url string, latency time.Duration) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	e := pool.find(url)
+	if e == nil {
+		return
+	}
+	e.consecutiveFailures = 0
+	e.ejectedUntil = time.Time{}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.latency))
+	}
+}
+
+func (pool *EndpointPool) RecordFailure(url string) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	e := pool.find(url)
+	if e == nil {
+		return
+	}
+	e.consecutiveFailures++
+	if e.consecutiveFailures >= pool.options.ConsecutiveFailures {
+		e.ejectedUntil = pool.timeNowFn().Add(pool.options.EjectionTime)
+	}
+}
+
+func (pool *EndpointPool) Health() []EndpointHealth {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	now := pool.timeNowFn()
+	health := make([]EndpointHealth, len(pool.endpoints))
+	for i, e := range pool.endpoints {
+		health[i] = EndpointHealth{
+			URL:                 e.url,
+			Healthy:             !now.Before(e.ejectedUntil),
+			ConsecutiveFailures: e.consecutiveFailures,
+			Latency:             e.latency,
+			EjectedUntil:        e.ejectedUntil,
+		}
+	}
+	return health
+}
+
+func (pool *EndpointPool) find(url string) *endpoint {
+	for _, e := range pool.endpoints {
+		if e.url == url {
+			return e
+		}
+	}
+	return nil
+}
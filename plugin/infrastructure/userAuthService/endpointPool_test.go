@@ -0,0 +1,174 @@
+package infrastructure
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+const (
+	zoneA = "https://zone-a.example"
+	zoneB = "https://zone-b.example"
+	zoneC = "https://zone-c.example"
+)
+
+func newTestPool(t *testing.T, strategy LoadBalancingStrategy) (*EndpointPool, *fakeClock) {
+	t.Helper()
+	pool, err := NewEndpointPool([]string{zoneA, zoneB, zoneC}, EndpointPoolOptions{
+		Strategy:            strategy,
+		ConsecutiveFailures: 2,
+		EjectionTime:        time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewEndpointPool failed: %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	pool.timeNowFn = clock.Now
+	return pool, clock
+}
+
+func requireCandidates(t *testing.T, pool *EndpointPool, expected ...string) {
+	t.Helper()
+	if candidates := pool.Candidates(); !slices.Equal(candidates, expected) {
+		t.Fatalf("expected candidates %v, got %v", expected, candidates)
+	}
+}
+
+func TestNewEndpointPoolValidation(t *testing.T) {
+	if _, err := NewEndpointPool(nil, EndpointPoolOptions{Strategy: LoadBalancingFailover}); err == nil {
+		t.Error("expected an error without endpoints")
+	}
+	if _, err := NewEndpointPool([]string{zoneA}, EndpointPoolOptions{Strategy: "random"}); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	pool, _ := newTestPool(t, LoadBalancingFailover)
+
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+	// The configured order is kept whatever the latency.
+	pool.RecordSuccess(zoneA, time.Second)
+	pool.RecordSuccess(zoneB, time.Millisecond)
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+	// A single failure is below the threshold.
+	pool.RecordFailure(zoneA)
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+}
+
+func TestEndpointPoolRoundRobin(t *testing.T) {
+	pool, _ := newTestPool(t, LoadBalancingRoundRobin)
+
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+	requireCandidates(t, pool, zoneB, zoneC, zoneA)
+	requireCandidates(t, pool, zoneC, zoneA, zoneB)
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+
+	// Ejected endpoints are left out of the rotation.
+	pool.RecordFailure(zoneB)
+	pool.RecordFailure(zoneB)
+	requireCandidates(t, pool, zoneA, zoneC, zoneB)
+	requireCandidates(t, pool, zoneC, zoneA, zoneB)
+}
+
+func TestEndpointPoolLeastLatency(t *testing.T) {
+	pool, _ := newTestPool(t, LoadBalancingLeastLatency)
+
+	// Endpoints without a measurement are tried first.
+	pool.RecordSuccess(zoneA, 300*time.Millisecond)
+	pool.RecordSuccess(zoneB, 100*time.Millisecond)
+	requireCandidates(t, pool, zoneC, zoneB, zoneA)
+
+	pool.RecordSuccess(zoneC, 200*time.Millisecond)
+	requireCandidates(t, pool, zoneB, zoneC, zoneA)
+
+	// The average moves towards new measurements: 0.3*1s + 0.7*100ms.
+	pool.RecordSuccess(zoneB, time.Second)
+	requireCandidates(t, pool, zoneC, zoneA, zoneB)
+	if latency := pool.Health()[1].Latency; latency != 370*time.Millisecond {
+		t.Errorf("expected a 370ms average latency, got %s", latency)
+	}
+}
+
+func TestEndpointPoolLeastLatencyCountsFailures(t *testing.T) {
+	pool, _ := newTestPool(t, LoadBalancingLeastLatency)
+	pool.RecordSuccess(zoneA, 10*time.Millisecond)
+	pool.RecordSuccess(zoneB, 100*time.Millisecond)
+	pool.RecordSuccess(zoneC, 200*time.Millisecond)
+
+	// The fastest endpoint failing fast is tried after the slower ones that
+	// answer, before being ejected.
+	pool.RecordFailure(zoneA)
+	requireCandidates(t, pool, zoneB, zoneC, zoneA)
+
+	pool.RecordSuccess(zoneA, 10*time.Millisecond)
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+}
+
+func TestEndpointPoolOutlierEjection(t *testing.T) {
+	pool, clock := newTestPool(t, LoadBalancingFailover)
+
+	pool.RecordFailure(zoneA)
+	pool.RecordFailure(zoneA)
+	requireCandidates(t, pool, zoneB, zoneC, zoneA)
+	health := pool.Health()[0]
+	if health.Healthy || health.ConsecutiveFailures != 2 || !health.EjectedUntil.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("expected zone A to be ejected for a minute, got %+v", health)
+	}
+
+	// With every endpoint ejected, those coming back first are tried first.
+	clock.advance(10 * time.Second)
+	pool.RecordFailure(zoneC)
+	pool.RecordFailure(zoneC)
+	clock.advance(10 * time.Second)
+	pool.RecordFailure(zoneB)
+	pool.RecordFailure(zoneB)
+	requireCandidates(t, pool, zoneA, zoneC, zoneB)
+
+	// A failure while ejected extends the ejection.
+	clock.advance(10 * time.Second)
+	pool.RecordFailure(zoneA)
+	requireCandidates(t, pool, zoneC, zoneB, zoneA)
+}
+
+func TestEndpointPoolRecovery(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		recover func(pool *EndpointPool, clock *fakeClock)
+	}{
+		{
+			name: "ejection time elapsed",
+			recover: func(pool *EndpointPool, clock *fakeClock) {
+				clock.advance(time.Minute)
+			},
+		},
+		{
+			name: "success while ejected",
+			recover: func(pool *EndpointPool, clock *fakeClock) {
+				pool.RecordSuccess(zoneA, time.Millisecond)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pool, clock := newTestPool(t, LoadBalancingFailover)
+			pool.RecordFailure(zoneA)
+			pool.RecordFailure(zoneA)
+			requireCandidates(t, pool, zoneB, zoneC, zoneA)
+
+			tc.recover(pool, clock)
+			requireCandidates(t, pool, zoneA, zoneB, zoneC)
+			if !pool.Health()[0].Healthy {
+				t.Errorf("expected zone A to be healthy, got %+v", pool.Health()[0])
+			}
+		})
+	}
+}
+
+func TestEndpointPoolSuccessResetsFailures(t *testing.T) {
+	pool, _ := newTestPool(t, LoadBalancingFailover)
+
+	pool.RecordFailure(zoneA)
+	pool.RecordSuccess(zoneA, time.Millisecond)
+	pool.RecordFailure(zoneA)
+	requireCandidates(t, pool, zoneA, zoneB, zoneC)
+}
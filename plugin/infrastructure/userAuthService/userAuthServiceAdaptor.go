@@ -1,15 +1,185 @@
 package infrastructure
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
 	"wl/plugin/domain"
 	"wl/plugin/presentation"
 )
 
+// UserAuthServiceAdaptor validates attestations with the auth service. Each
+// attestation is POSTed with Content-Type application/json to the endpoints
+// in the order of the pool:
+//
+//	{
+//	  "token": "<module token>",
+//	  "user_info": {
+//	    "name": "alice",
+//	    "secret": "<module secret>",
+//	    "system_info": {
+//	      "user_id": "1001", "username": "alice",
+//	      "group_id": "1001", "group_name": "alice",
+//	      "supplementary_groups": [{"group_id": "27", "group_name": "sudo"}]
+//	    }
+//	  }
+//	}
+//
+// and the endpoint answers with:
+//
+//	{"is_valid": true, "message": "ok", "expires_at": 1767225600}
+//
+// where expires_at, the unix time at which the token expires, is optional.
+// A 2xx answer, or a 4xx one that is not valid, is the decision of the
+// service; any other answer, a transport error or an undecodable body is a
+// failure of the endpoint, and the next one is tried.
 type UserAuthServiceAdaptor struct {
-	ServiceURL string
+	Endpoints  *EndpointPool
+	HTTPClient *http.Client
+	// OnExchange, when set, is called with every answer of an endpoint, e.g.
+	// for debug logging. The exchange holds the token and the user secret.
+	OnExchange func(exchange AuthServiceExchange)
 	presentation.UserAuthService
 }
 
+// AuthServiceExchange is a validation request and the answer of an endpoint.
+type AuthServiceExchange struct {
+	URL            string
+	StatusCode     int
+	RequestHeader  http.Header
+	Request        []byte
+	ResponseHeader http.Header
+	Response       []byte
+}
+
+// validationRequest and validationResponse are the documented wire format
+// above, changing them breaks deployed auth services.
+type validationRequest struct {
+	Token    string          `json:"token"`
+	UserInfo userInfoPayload `json:"user_info"`
+}
+
+type userInfoPayload struct {
+	Name       string            `json:"name"`
+	Secret     string            `json:"secret"`
+	SystemInfo systemInfoPayload `json:"system_info"`
+}
+
+type systemInfoPayload struct {
+	UserID              string             `json:"user_id"`
+	Username            string             `json:"username"`
+	GroupID             string             `json:"group_id"`
+	GroupName           string             `json:"group_name"`
+	SupplementaryGroups []groupInfoPayload `json:"supplementary_groups"`
+}
+
+type groupInfoPayload struct {
+	GroupID   string `json:"group_id"`
+	GroupName string `json:"group_name"`
+}
+
+type validationResponse struct {
+	IsValid bool   `json:"is_valid"`
+	Message string `json:"message"`
+	// ExpiresAt is the unix time at which the token expires, when known.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
 func (adaptor UserAuthServiceAdaptor) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
-	return domain.UserAttestationValidation{IsValid: true, Message: "valid"}, nil
+	body, err := json.Marshal(newValidationRequest(data))
+	if err != nil {
+		return domain.UserAttestationValidation{}, fmt.Errorf("failed to encode validation request: %w", err)
+	}
+
+	var errs []error
+	for _, url := range adaptor.Endpoints.Candidates() {
+		start := time.Now()
+		result, err := adaptor.validateWith(url, body)
+		if err != nil {
+			adaptor.Endpoints.RecordFailure(url)
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		adaptor.Endpoints.RecordSuccess(url, time.Since(start))
+		return result, nil
+	}
+	return domain.UserAttestationValidation{}, fmt.Errorf("all auth service endpoints failed: %w", errors.Join(errs...))
+}
+
+func (adaptor UserAuthServiceAdaptor) validateWith(url string, body []byte) (domain.UserAttestationValidation, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return domain.UserAttestationValidation{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := adaptor.HTTPClient.Do(req)
+	if err != nil {
+		return domain.UserAttestationValidation{}, err
+	}
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return domain.UserAttestationValidation{}, fmt.Errorf("failed to read validation response: %w", err)
+	}
+	if adaptor.OnExchange != nil {
+		adaptor.OnExchange(AuthServiceExchange{
+			URL:            url,
+			StatusCode:     res.StatusCode,
+			RequestHeader:  req.Header,
+			Request:        body,
+			ResponseHeader: res.Header,
+			Response:       content,
+		})
+	}
+
+	// A 4xx answer is a decision of the service about this request, anything
+	// else that is not a success means the endpoint is unhealthy.
+	if res.StatusCode >= 500 {
+		return domain.UserAttestationValidation{}, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	var payload validationResponse
+	if err := json.Unmarshal(content, &payload); err != nil {
+		return domain.UserAttestationValidation{}, fmt.Errorf("failed to decode validation response: %w", err)
+	}
+	if res.StatusCode >= 300 && payload.IsValid {
+		return domain.UserAttestationValidation{}, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	result := domain.UserAttestationValidation{IsValid: payload.IsValid, Message: payload.Message}
+	if payload.ExpiresAt > 0 {
+		result.ExpiresAt = time.Unix(payload.ExpiresAt, 0)
+	}
+	return result, nil
+}
+
+// Close drops the idle keep-alive connections to the endpoints.
+func (adaptor UserAuthServiceAdaptor) Close() error {
+	adaptor.HTTPClient.CloseIdleConnections()
+	return nil
+}
+
+func newValidationRequest(data *domain.UserAttestation) validationRequest {
+	groups := make([]groupInfoPayload, len(data.UserInfo.SystemInfo.SupplementaryGroups))
+	for i, group := range data.UserInfo.SystemInfo.SupplementaryGroups {
+		groups[i] = groupInfoPayload{GroupID: group.GroupID, GroupName: group.GroupName}
+	}
+	return validationRequest{
+		Token: data.Token,
+		UserInfo: userInfoPayload{
+			Name:   data.UserInfo.Name,
+			Secret: data.UserInfo.Secret,
+			SystemInfo: systemInfoPayload{
+				UserID:              data.UserInfo.SystemInfo.UserID,
+				Username:            data.UserInfo.SystemInfo.Username,
+				GroupID:             data.UserInfo.SystemInfo.GroupID,
+				GroupName:           data.UserInfo.SystemInfo.GroupName,
+				SupplementaryGroups: groups,
+			},
+		},
+	}
 }
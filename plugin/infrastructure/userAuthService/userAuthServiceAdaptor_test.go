@@ -0,0 +1,111 @@
+package infrastructure
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+)
+
+func newTestAdaptor(t *testing.T, urls ...string) UserAuthServiceAdaptor {
+	t.Helper()
+	pool, err := NewEndpointPool(urls, EndpointPoolOptions{Strategy: LoadBalancingFailover, ConsecutiveFailures: 3, EjectionTime: time.Minute})
+	if err != nil {
+		t.Fatalf("NewEndpointPool failed: %v", err)
+	}
+	return UserAuthServiceAdaptor{Endpoints: pool, HTTPClient: &http.Client{Timeout: time.Second}}
+}
+
+func answer(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestValidateDataRequest(t *testing.T) {
+	var request []byte
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected %s request with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		request, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"is_valid": true, "message": "ok", "expires_at": 1767225600}`))
+	}))
+	defer service.Close()
+
+	result, err := newTestAdaptor(t, service.URL).ValidateData(&domain.UserAttestation{
+		Token: "token",
+		UserInfo: domain.UserInfo{
+			Name:   "alice",
+			Secret: "secret",
+			SystemInfo: domain.SystemInfo{
+				UserID:              "1001",
+				Username:            "alice",
+				GroupID:             "1001",
+				GroupName:           "alice",
+				SupplementaryGroups: []domain.GroupInfo{{GroupID: "27", GroupName: "sudo"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ValidateData failed: %v", err)
+	}
+	if !result.IsValid || result.Message != "ok" || !result.ExpiresAt.Equal(time.Unix(1767225600, 0)) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	expected := `{"token":"token","user_info":{"name":"alice","secret":"secret","system_info":{"user_id":"1001","username":"alice","group_id":"1001","group_name":"alice","supplementary_groups":[{"group_id":"27","group_name":"sudo"}]}}}`
+	if string(request) != expected {
+		t.Errorf("unexpected request\n got: %s\nwant: %s", request, expected)
+	}
+}
+
+func TestValidateDataAnswers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		body     string
+		valid    bool
+		failover bool
+	}{
+		{name: "accepted", status: http.StatusOK, body: `{"is_valid": true}`, valid: true},
+		{name: "rejected", status: http.StatusOK, body: `{"is_valid": false, "message": "revoked"}`},
+		{name: "rejected with a client error", status: http.StatusForbidden, body: `{"is_valid": false, "message": "revoked"}`},
+		{name: "client error claiming validity", status: http.StatusForbidden, body: `{"is_valid": true}`, failover: true},
+		{name: "server error", status: http.StatusServiceUnavailable, body: `{"is_valid": false}`, failover: true},
+		{name: "undecodable body", status: http.StatusOK, body: `<html>`, failover: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := answer(tc.status, tc.body)
+			defer primary.Close()
+			secondary := answer(http.StatusOK, `{"is_valid": true, "message": "secondary"}`)
+			defer secondary.Close()
+
+			result, err := newTestAdaptor(t, primary.URL, secondary.URL).ValidateData(&domain.UserAttestation{Token: "token"})
+			if err != nil {
+				t.Fatalf("ValidateData failed: %v", err)
+			}
+			if tc.failover {
+				if result.Message != "secondary" {
+					t.Fatalf("expected the secondary endpoint to answer, got %+v", result)
+				}
+				return
+			}
+			if result.IsValid != tc.valid || result.Message == "secondary" {
+				t.Errorf("expected the primary decision, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestValidateDataAllEndpointsFailed(t *testing.T) {
+	service := answer(http.StatusInternalServerError, "")
+	defer service.Close()
+
+	if _, err := newTestAdaptor(t, service.URL).ValidateData(&domain.UserAttestation{}); err == nil {
+		t.Fatal("expected an error when no endpoint answers")
+	}
+}
@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"errors"
+	"wl/plugin/domain"
+	adAdptr "wl/plugin/infrastructure/accountDatabase"
+	pfAdptr "wl/plugin/infrastructure/procfs"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// getLoginSelectors describes the login session of the attested process, which
+// survives sudo and su, and enforces require_login_user_match.
+func (p *Plugin) getLoginSelectors(config *Config, pid int32, attestationData *domain.UserAttestation) ([]string, error) {
+	procFS := pfAdptr.ProcFS{Root: config.ProcRoot}
+
+	loginUID, hasLogin, err := procFS.LoginUID(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process login uid", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read login uid of process %d: %v", pid, err)
+	}
+	if !hasLogin {
+		if config.RequireLoginUserMatch {
+			p.logger.Error("Process does not belong to a login session", "pid", pid)
+			return nil, status.Errorf(codes.PermissionDenied, "process %d does not belong to a login session", pid)
+		}
+		return nil, nil
+	}
+
+	selectors := appendSelector([]string{}, "login:uid", loginUID)
+
+	loginUsername := ""
+	account, err := adAdptr.AccountDatabase{EtcDir: config.EtcRoot}.LookupUserID(loginUID)
+	switch {
+	case err == nil:
+		loginUsername = account.Username
+		selectors = appendSelector(selectors, "login:username", loginUsername)
+	case !errors.Is(err, adAdptr.ErrNotFound):
+		p.logger.Error("Failed to read the account database", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read the account database: %v", err)
+	}
+
+	sessionID, hasSession, err := procFS.SessionID(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process session id", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read session id of process %d: %v", pid, err)
+	}
+	if hasSession {
+		selectors = appendSelector(selectors, "login:session_id", sessionID)
+	}
+
+	if config.RequireLoginUserMatch && attestationData.UserInfo.Name != loginUsername {
+		p.logger.Error("Module user is not the login user of the process",
+			"pid", pid,
+			"user", attestationData.UserInfo.Name,
+			"login_uid", loginUID,
+			"login_username", loginUsername,
+		)
+		return nil, status.Errorf(codes.PermissionDenied, "user %q is not the login user of process %d", attestationData.UserInfo.Name, pid)
+	}
+	return selectors, nil
+}
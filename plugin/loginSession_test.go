@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+// writeProcess creates a process with the given files in a temporary procfs.
+func writeProcess(t *testing.T, pid int32, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, strconv.Itoa(int(pid)))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestGetLoginSelectors(t *testing.T) {
+	p, config := newInspectionTest(t, "")
+
+	selectors, err := p.getLoginSelectors(config, hostPid, newAliceAttestation())
+	if err != nil {
+		t.Fatalf("getLoginSelectors failed: %v", err)
+	}
+	expected := []string{"login:uid:1001", "login:username:alice", "login:session_id:7"}
+	if !slices.Equal(selectors, expected) {
+		t.Errorf("expected %v, got %v", expected, selectors)
+	}
+
+	// Without require_login_user_match another user only gets the selectors.
+	root := newAliceAttestation()
+	root.UserInfo.Name = "root"
+	if _, err := p.getLoginSelectors(config, hostPid, root); err != nil {
+		t.Errorf("expected no login user match to be required, got %v", err)
+	}
+
+	selectors, err = p.getLoginSelectors(config, containerPid, newAliceAttestation())
+	if err != nil || len(selectors) != 0 {
+		t.Errorf("expected no selector outside a login session, got %v, %v", selectors, err)
+	}
+}
+
+func TestGetLoginSelectorsRequireLoginUserMatch(t *testing.T) {
+	p, config := newInspectionTest(t, `require_login_user_match = true`)
+
+	if _, err := p.getLoginSelectors(config, hostPid, newAliceAttestation()); err != nil {
+		t.Fatalf("expected the login user to match, got %v", err)
+	}
+
+	root := newAliceAttestation()
+	root.UserInfo.Name = "root"
+	_, err := p.getLoginSelectors(config, hostPid, root)
+	requireCode(t, err, codes.PermissionDenied)
+
+	_, err = p.getLoginSelectors(config, containerPid, newAliceAttestation())
+	requireCode(t, err, codes.PermissionDenied)
+}
+
+func TestGetLoginSelectorsUnknownLoginUser(t *testing.T) {
+	p, config := newInspectionTest(t, "")
+	config.ProcRoot = writeProcess(t, hostPid, map[string]string{"loginuid": "2000\n", "sessionid": "4294967295\n"})
+
+	selectors, err := p.getLoginSelectors(config, hostPid, newAliceAttestation())
+	if err != nil {
+		t.Fatalf("getLoginSelectors failed: %v", err)
+	}
+	if !slices.Equal(selectors, []string{"login:uid:2000"}) {
+		t.Errorf("expected only the login uid, got %v", selectors)
+	}
+
+	config.RequireLoginUserMatch = true
+	_, err = p.getLoginSelectors(config, hostPid, newAliceAttestation())
+	requireCode(t, err, codes.PermissionDenied)
+}
+
+func TestGetLoginSelectorsErrors(t *testing.T) {
+	p, config := newInspectionTest(t, "")
+
+	_, err := p.getLoginSelectors(config, 9999, newAliceAttestation())
+	requireCode(t, err, codes.Internal)
+
+	config.ProcRoot = writeProcess(t, hostPid, map[string]string{"loginuid": "1001"})
+	_, err = p.getLoginSelectors(config, hostPid, newAliceAttestation())
+	requireCode(t, err, codes.Internal)
+
+	config.ProcRoot = "testdata/proc"
+	config.EtcRoot = "testdata/missing"
+	_, err = p.getLoginSelectors(config, hostPid, newAliceAttestation())
+	requireCode(t, err, codes.Internal)
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// metrics are published through expvar and served on metrics_address.
+var metrics = expvar.NewMap("user_wl_attestor")
+
+// metricsHandler serves the plugin metrics in the expvar format, leaving out
+// the rest of the process registry such as its command line and memstats.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n%q: %s\n}\n", "user_wl_attestor", metrics.String())
+}
+
+// metricsListenAddress listens on loopback when address has no host, rather
+// than on every interface.
+func metricsListenAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != "" {
+		return address
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// serveMetrics serves the metrics on address, replacing the server of a
+// previous configuration when the address changed.
+func (p *Plugin) serveMetrics(address string) error {
+	p.metricsMtx.Lock()
+	defer p.metricsMtx.Unlock()
+
+	address = metricsListenAddress(address)
+
+	if p.metricsServer != nil && p.metricsServer.Addr == address {
+		return nil
+	}
+	if address == "" {
+		p.stopMetricsLocked()
+		return nil
+	}
+
+	// The previous server keeps running when the new address cannot be used.
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	p.stopMetricsLocked()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vars", metricsHandler)
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Error("Metrics server stopped", "address", address, "error", err)
+		}
+	}()
+	p.metricsServer = server
+	return nil
+}
+
+func (p *Plugin) stopMetrics() {
+	p.metricsMtx.Lock()
+	defer p.metricsMtx.Unlock()
+	p.stopMetricsLocked()
+}
+
+func (p *Plugin) stopMetricsLocked() {
+	if p.metricsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.metricsServer.Shutdown(ctx); err != nil {
+		p.logger.Warn("Failed to stop the metrics server", "error", err)
+	}
+	p.metricsServer = nil
+}
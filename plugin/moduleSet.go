@@ -0,0 +1,265 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+	"wl/plugin/domain"
+	uamAdptr "wl/plugin/infrastructure/userAttestationModule"
+	"wl/plugin/presentation"
+
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// moduleConflictError is returned when two modules report different users
+// for the same attestation.
+type moduleConflictError struct {
+	field       string
+	module      string
+	value       string
+	otherModule string
+	otherValue  string
+}
+
+func (err *moduleConflictError) Error() string {
+	return fmt.Sprintf("modules %q and %q disagree on the %s: %q != %q", err.module, err.otherModule, err.field, err.value, err.otherValue)
+}
+
+type moduleMember struct {
+	name           string
+	selectorPrefix string
+	module         presentation.UserAttestorModule
+}
+
+type moduleResult struct {
+	attestation *domain.UserAttestation
+	err         error
+}
+
+// moduleSet queries its modules in parallel and combines their answers:
+//   - first_success uses the first module, in configuration order, that
+//     answers. It returns as soon as that module answered and every module
+//     before it failed, the answers of later modules are ignored.
+//   - all_required needs every module to answer and to agree on the user.
+//   - merge combines the modules that answer, which must agree on the user.
+//
+// Modules that are combined contribute their supplementary groups and fill in
+// what the first of them left empty.
+type moduleSet struct {
+	presentation.UserAttestorModule
+	mode    string
+	members []moduleMember
+
+	// minBackoff and maxBackoff bound the wait before a broken session event
+	// stream is reopened.
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	stopWatching context.CancelFunc
+	watchers     sync.WaitGroup
+}
+
+func newModuleSet(config *Config, logger hclog.Logger) (*moduleSet, error) {
+	set := &moduleSet{
+		mode:       config.ModulesMode,
+		minBackoff: sessionEventsMinBackoff,
+		maxBackoff: sessionEventsMaxBackoff,
+	}
+	for _, moduleConfig := range config.Modules {
+		module, err := uamAdptr.NewUserAttestorModuleAdaptor(uamAdptr.UserAttestorModuleOptions{
+			Transport:  moduleConfig.Transport,
+			Address:    moduleConfig.Address,
+			MinVersion: moduleConfig.MinVersion,
+			OnExchange: moduleExchangeLogger(config, logger, moduleConfig.Name),
+		})
+		if err != nil {
+			set.Close()
+			return nil, status.Errorf(codes.InvalidArgument, "invalid module %q: %v", moduleConfig.Name, err)
+		}
+		set.members = append(set.members, moduleMember{
+			name:           moduleConfig.Name,
+			selectorPrefix: moduleConfig.SelectorPrefix,
+			module:         module,
+		})
+	}
+	return set, nil
+}
+
+func (set *moduleSet) GetUserAttestationData(pid int32, nonce []byte) (*domain.UserAttestation, error) {
+	results := make([]chan moduleResult, len(set.members))
+	for i, member := range set.members {
+		results[i] = make(chan moduleResult, 1)
+		go func() {
+			attestation, err := member.module.GetUserAttestationData(pid, nonce)
+			results[i] <- moduleResult{attestation: attestation, err: err}
+		}()
+	}
+
+	var combined *domain.UserAttestation
+	var errs []error
+	for i, member := range set.members {
+		result := <-results[i]
+		if result.err != nil {
+			if set.mode == modulesModeAllRequired {
+				return nil, fmt.Errorf("module %q: %w", member.name, result.err)
+			}
+			errs = append(errs, fmt.Errorf("module %q: %w", member.name, result.err))
+			continue
+		}
+
+		if combined != nil {
+			if err := checkModuleConflict(combined, member.name, result.attestation); err != nil {
+				return nil, err
+			}
+			mergeModuleAttestation(combined, result.attestation)
+		} else {
+			combined = result.attestation
+		}
+		combined.Sources = append(combined.Sources, domain.AttestationSource{
+			Module:         member.name,
+			SelectorPrefix: member.selectorPrefix,
+			UserInfo:       result.attestation.UserInfo,
+		})
+		if set.mode == modulesModeFirstSuccess {
+			// The results channels are buffered, the modules still running
+			// finish in the background.
+			break
+		}
+	}
+	if combined == nil {
+		return nil, errors.Join(errs...)
+	}
+	return combined, nil
+}
+
+// moduleNegotiator is implemented by modules that agree on capabilities with
+// the plugin.
+type moduleNegotiator interface {
+	Negotiate() (domain.ModuleCapabilities, error)
+}
+
+// negotiate agrees on capabilities with every module right after Configure.
+// Unreachable modules are only reported, as they are retried on first use, but
+// incompatible ones fail the configuration.
+func (set *moduleSet) negotiate(logger hclog.Logger) error {
+	for _, member := range set.members {
+		negotiator, ok := member.module.(moduleNegotiator)
+		if !ok {
+			continue
+		}
+		capabilities, err := negotiator.Negotiate()
+		if errors.Is(err, uamAdptr.ErrIncompatibleModule) {
+			return status.Errorf(codes.FailedPrecondition, "module %q: %v", member.name, err)
+		}
+		if err != nil {
+			logger.Warn("Failed to negotiate with the user attestation module, retrying on first attestation", "module", member.name, "error", err)
+			continue
+		}
+		logger.Info("Negotiated with the user attestation module",
+			"module", member.name,
+			"module_name", capabilities.Name,
+			"module_version", capabilities.Version,
+			"protocol_version", capabilities.ProtocolVersion,
+			"features", capabilities.Features,
+		)
+	}
+	return nil
+}
+
+// Close stops watching session events and closes the connections to all
+// modules.
+func (set *moduleSet) Close() error {
+	if set.stopWatching != nil {
+		set.stopWatching()
+		set.watchers.Wait()
+	}
+
+	var errs []error
+	for _, member := range set.members {
+		if closer, ok := member.module.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkModuleConflict fails when another module reported a different user
+// than the combined attestation.
+func checkModuleConflict(combined *domain.UserAttestation, module string, other *domain.UserAttestation) error {
+	first := combined.Sources[0].Module
+	user, otherUser := &combined.UserInfo, other.UserInfo
+	for _, field := range []struct{ name, value, otherValue string }{
+		{"user name", user.Name, otherUser.Name},
+		{"username", user.SystemInfo.Username, otherUser.SystemInfo.Username},
+		{"user id", user.SystemInfo.UserID, otherUser.SystemInfo.UserID},
+	} {
+		if field.value != "" && field.otherValue != "" && field.value != field.otherValue {
+			return &moduleConflictError{
+				field:       field.name,
+				module:      first,
+				value:       field.value,
+				otherModule: module,
+				otherValue:  field.otherValue,
+			}
+		}
+	}
+	return nil
+}
+
+// mergeModuleAttestation adds what another module reported about the same
+// user to the combined attestation.
+func mergeModuleAttestation(combined *domain.UserAttestation, other *domain.UserAttestation) {
+	user, otherUser := &combined.UserInfo, other.UserInfo
+	fill := func(value *string, otherValue string) {
+		if *value == "" {
+			*value = otherValue
+		}
+	}
+	fill(&user.Name, otherUser.Name)
+	fill(&user.Secret, otherUser.Secret)
+	fill(&user.SystemInfo.Username, otherUser.SystemInfo.Username)
+	fill(&user.SystemInfo.UserID, otherUser.SystemInfo.UserID)
+	fill(&user.SystemInfo.GroupID, otherUser.SystemInfo.GroupID)
+	fill(&user.SystemInfo.GroupName, otherUser.SystemInfo.GroupName)
+	if combined.Token == "" {
+		combined.Token, combined.TokenExpiresAt = other.Token, other.TokenExpiresAt
+	}
+	// The certificate and its signature are only meaningful together.
+	if combined.SSHCertificate == "" {
+		combined.SSHCertificate, combined.SSHSignature = other.SSHCertificate, other.SSHSignature
+	}
+
+	for _, group := range otherUser.SystemInfo.SupplementaryGroups {
+		if !slices.ContainsFunc(user.SystemInfo.SupplementaryGroups, func(known domain.GroupInfo) bool {
+			return sameGroup(known, group)
+		}) {
+			user.SystemInfo.SupplementaryGroups = append(user.SystemInfo.SupplementaryGroups, group)
+		}
+	}
+}
+
+func sameGroup(group, other domain.GroupInfo) bool {
+	if group.GroupID != "" && other.GroupID != "" {
+		return group.GroupID == other.GroupID
+	}
+	return group.GroupName == other.GroupName
+}
+
+// buildSourceSelectors adds the prefixed selectors of the modules that
+// reported the user. Values buildSelectors would reject are left out.
+func buildSourceSelectors(sources []domain.AttestationSource) []string {
+	selectors := []string{}
+	for _, source := range sources {
+		if source.SelectorPrefix == "" {
+			continue
+		}
+		selectors = appendSelector(selectors, source.SelectorPrefix+":name", source.UserInfo.Name)
+		selectors = appendSelector(selectors, source.SelectorPrefix+":username", source.UserInfo.SystemInfo.Username)
+	}
+	return selectors
+}
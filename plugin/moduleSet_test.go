@@ -0,0 +1,255 @@
+package plugin
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+)
+
+var errModuleDown = errors.New("module down")
+
+// answeringModule reports a copy of its user, or fails with err when set.
+type answeringModule struct {
+	presentation.UserAttestorModule
+	user domain.UserInfo
+	err  error
+}
+
+func (module answeringModule) GetUserAttestationData(pid int32, nonce []byte) (*domain.UserAttestation, error) {
+	if module.err != nil {
+		return nil, module.err
+	}
+	user := module.user
+	user.SystemInfo.SupplementaryGroups = slices.Clone(user.SystemInfo.SupplementaryGroups)
+	return &domain.UserAttestation{Token: "token-" + user.Name, UserInfo: user}, nil
+}
+
+func aliceWith(groups ...domain.GroupInfo) answeringModule {
+	return answeringModule{user: domain.UserInfo{
+		Name: "alice",
+		SystemInfo: domain.SystemInfo{
+			UserID:              "1001",
+			Username:            "alice",
+			SupplementaryGroups: groups,
+		},
+	}}
+}
+
+var (
+	sudoGroup   = domain.GroupInfo{GroupID: "27", GroupName: "sudo"}
+	dockerGroup = domain.GroupInfo{GroupID: "999", GroupName: "docker"}
+	downModule  = answeringModule{err: errModuleDown}
+)
+
+func newTestModuleSet(mode string, modules ...answeringModule) *moduleSet {
+	set := &moduleSet{mode: mode}
+	for i, module := range modules {
+		name := string(rune('a' + i))
+		set.members = append(set.members, moduleMember{name: name, selectorPrefix: "module_" + name, module: module})
+	}
+	return set
+}
+
+func sourceModules(attestation *domain.UserAttestation) []string {
+	modules := []string{}
+	for _, source := range attestation.Sources {
+		modules = append(modules, source.Module)
+	}
+	return modules
+}
+
+func TestModuleSetModes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mode    string
+		modules []answeringModule
+		groups  []domain.GroupInfo
+		sources []string
+		err     bool
+	}{
+		{
+			name:    "first_success uses the first module",
+			mode:    modulesModeFirstSuccess,
+			modules: []answeringModule{aliceWith(sudoGroup), aliceWith(dockerGroup)},
+			groups:  []domain.GroupInfo{sudoGroup},
+			sources: []string{"a"},
+		},
+		{
+			name:    "first_success skips failing modules",
+			mode:    modulesModeFirstSuccess,
+			modules: []answeringModule{downModule, aliceWith(dockerGroup), aliceWith(sudoGroup)},
+			groups:  []domain.GroupInfo{dockerGroup},
+			sources: []string{"b"},
+		},
+		{
+			name:    "first_success without an answer",
+			mode:    modulesModeFirstSuccess,
+			modules: []answeringModule{downModule, downModule},
+			err:     true,
+		},
+		{
+			name:    "all_required merges every module",
+			mode:    modulesModeAllRequired,
+			modules: []answeringModule{aliceWith(sudoGroup), aliceWith(dockerGroup, sudoGroup)},
+			groups:  []domain.GroupInfo{sudoGroup, dockerGroup},
+			sources: []string{"a", "b"},
+		},
+		{
+			name:    "all_required with a failing module",
+			mode:    modulesModeAllRequired,
+			modules: []answeringModule{aliceWith(sudoGroup), downModule},
+			err:     true,
+		},
+		{
+			name:    "merge skips failing modules",
+			mode:    modulesModeMerge,
+			modules: []answeringModule{aliceWith(sudoGroup), downModule, aliceWith(dockerGroup)},
+			groups:  []domain.GroupInfo{sudoGroup, dockerGroup},
+			sources: []string{"a", "c"},
+		},
+		{
+			name:    "merge without an answer",
+			mode:    modulesModeMerge,
+			modules: []answeringModule{downModule},
+			err:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attestation, err := newTestModuleSet(tc.mode, tc.modules...).GetUserAttestationData(4242, nil)
+			if tc.err {
+				if !errors.Is(err, errModuleDown) {
+					t.Fatalf("expected the module error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserAttestationData failed: %v", err)
+			}
+			if groups := attestation.UserInfo.SystemInfo.SupplementaryGroups; !slices.Equal(groups, tc.groups) {
+				t.Errorf("expected groups %v, got %v", tc.groups, groups)
+			}
+			if sources := sourceModules(attestation); !slices.Equal(sources, tc.sources) {
+				t.Errorf("expected sources %v, got %v", tc.sources, sources)
+			}
+		})
+	}
+}
+
+func TestModuleSetConflicts(t *testing.T) {
+	bob := aliceWith()
+	bob.user.Name = "bob"
+	otherUID := aliceWith()
+	otherUID.user.SystemInfo.UserID = "1002"
+	otherUsername := aliceWith()
+	otherUsername.user.SystemInfo.Username = "root"
+
+	for _, mode := range []string{modulesModeAllRequired, modulesModeMerge} {
+		for name, conflicting := range map[string]answeringModule{"user name": bob, "user id": otherUID, "username": otherUsername} {
+			t.Run(mode+"/"+name, func(t *testing.T) {
+				modules := []answeringModule{aliceWith(), downModule, conflicting}
+				if mode == modulesModeAllRequired {
+					// A failing module fails all_required before the conflict is seen.
+					modules = []answeringModule{aliceWith(), conflicting}
+				}
+				_, err := newTestModuleSet(mode, modules...).GetUserAttestationData(4242, nil)
+				var conflictErr *moduleConflictError
+				if !errors.As(err, &conflictErr) {
+					t.Fatalf("expected a conflict, got %v", err)
+				}
+				if conflictErr.field != name || conflictErr.module != "a" {
+					t.Errorf("unexpected conflict %+v", conflictErr)
+				}
+			})
+		}
+	}
+}
+
+// slowModule answers like its module once released.
+type slowModule struct {
+	answeringModule
+	release chan struct{}
+}
+
+func (module slowModule) GetUserAttestationData(pid int32, nonce []byte) (*domain.UserAttestation, error) {
+	<-module.release
+	return module.answeringModule.GetUserAttestationData(pid, nonce)
+}
+
+func TestModuleSetFirstSuccessDoesNotWaitForLaterModules(t *testing.T) {
+	first := slowModule{answeringModule: downModule, release: make(chan struct{})}
+	last := slowModule{answeringModule: aliceWith(sudoGroup), release: make(chan struct{})}
+	defer close(last.release)
+	set := &moduleSet{mode: modulesModeFirstSuccess, members: []moduleMember{
+		{name: "a", module: first},
+		{name: "b", module: aliceWith(dockerGroup)},
+		{name: "c", module: last},
+	}}
+
+	answered := make(chan *domain.UserAttestation, 1)
+	go func() {
+		attestation, err := set.GetUserAttestationData(4242, nil)
+		if err != nil {
+			t.Errorf("GetUserAttestationData failed: %v", err)
+		}
+		answered <- attestation
+	}()
+
+	// The first module comes first however slow it is.
+	select {
+	case <-answered:
+		t.Fatal("answered before the first module failed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(first.release)
+
+	select {
+	case attestation := <-answered:
+		if attestation == nil {
+			return
+		}
+		if sources := sourceModules(attestation); !slices.Equal(sources, []string{"b"}) {
+			t.Errorf("expected the second module to answer, got %v", sources)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waited for the last module")
+	}
+}
+
+func TestModuleSetFillsInMissingFields(t *testing.T) {
+	partial := answeringModule{user: domain.UserInfo{Name: "alice"}}
+	complete := aliceWith(sudoGroup)
+	complete.user.Secret = "secret"
+	complete.user.SystemInfo.GroupID = "1001"
+
+	attestation, err := newTestModuleSet(modulesModeMerge, partial, complete).GetUserAttestationData(4242, nil)
+	if err != nil {
+		t.Fatalf("GetUserAttestationData failed: %v", err)
+	}
+	systemInfo := attestation.UserInfo.SystemInfo
+	if systemInfo.UserID != "1001" || systemInfo.Username != "alice" || systemInfo.GroupID != "1001" || attestation.UserInfo.Secret != "secret" {
+		t.Errorf("expected the missing fields to be filled in, got %+v", attestation.UserInfo)
+	}
+	// The token of the first module is kept.
+	if attestation.Token != "token-alice" {
+		t.Errorf("unexpected token %q", attestation.Token)
+	}
+	// Sources keep what each module reported.
+	if attestation.Sources[0].UserInfo.SystemInfo.UserID != "" {
+		t.Errorf("expected the first source to be left unchanged, got %+v", attestation.Sources[0])
+	}
+}
+
+func TestBuildSourceSelectors(t *testing.T) {
+	sources := []domain.AttestationSource{
+		{Module: "laptop", SelectorPrefix: "laptop", UserInfo: domain.UserInfo{Name: "alice", SystemInfo: domain.SystemInfo{Username: "alice"}}},
+		{Module: "unprefixed", UserInfo: domain.UserInfo{Name: "alice"}},
+		{Module: "sso", SelectorPrefix: "sso", UserInfo: domain.UserInfo{Name: "alice@example.com", SystemInfo: domain.SystemInfo{Username: "alice\nroot"}}},
+	}
+	expected := []string{"laptop:name:alice", "laptop:username:alice", "sso:name:alice@example.com"}
+	if selectors := buildSourceSelectors(sources); !slices.Equal(selectors, expected) {
+		t.Errorf("expected %v, got %v", expected, selectors)
+	}
+}
@@ -0,0 +1,7 @@
+package presentation
+
+import "wl/plugin/domain"
+
+type PolicyEngine interface {
+	Evaluate(input domain.PolicyInput) (domain.PolicyDecision, error)
+}
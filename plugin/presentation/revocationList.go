@@ -0,0 +1,6 @@
+package presentation
+
+type RevocationList interface {
+	// IsRevoked fails when the list cannot be trusted to be complete.
+	IsRevoked(token string) (bool, error)
+}
@@ -0,0 +1,12 @@
+package presentation
+
+import (
+	"context"
+	"wl/plugin/domain"
+)
+
+type SessionEventSource interface {
+	// WatchSessionEvents calls handle for every session event until the
+	// stream breaks or ctx is done.
+	WatchSessionEvents(ctx context.Context, handle func(domain.SessionEvent)) error
+}
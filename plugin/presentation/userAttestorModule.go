@@ -5,5 +5,5 @@ import (
 )
 
 type UserAttestorModule interface {
-	GetUserAttestationData() (*domain.UserAttestation, error)
+	GetUserAttestationData(pid int32, nonce []byte) (*domain.UserAttestation, error)
 }
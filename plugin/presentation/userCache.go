@@ -0,0 +1,7 @@
+package presentation
+
+// UserCache is implemented by adaptors keeping results per user that must be
+// dropped when the user's session changes.
+type UserCache interface {
+	InvalidateUser(name string)
+}
@@ -0,0 +1,7 @@
+package presentation
+
+import "wl/plugin/domain"
+
+type UserDirectory interface {
+	LookupUser(username string) (*domain.DirectoryUser, error)
+}
@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"wl/plugin/domain"
+	pfAdptr "wl/plugin/infrastructure/procfs"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkProcessGroups keeps only the supplementary groups the kernel reports for
+// the attested process, or rejects the attestation when the module reported
+// any other group.
+func (p *Plugin) checkProcessGroups(config *Config, pid int32, attestationData *domain.UserAttestation) (*domain.UserAttestation, error) {
+	processGroups, err := pfAdptr.ProcFS{Root: config.ProcRoot}.SupplementaryGroups(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process groups", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read groups of process %d: %v", pid, err)
+	}
+	inProcess := make(map[string]bool, len(processGroups))
+	for _, group := range processGroups {
+		inProcess[group] = true
+	}
+
+	kept := []domain.GroupInfo{}
+	missing := []string{}
+	for _, group := range attestationData.UserInfo.SystemInfo.SupplementaryGroups {
+		if inProcess[group.GroupID] {
+			kept = append(kept, group)
+			continue
+		}
+		missing = append(missing, group.GroupID+"/"+group.GroupName)
+	}
+	if len(missing) == 0 {
+		return attestationData, nil
+	}
+
+	if config.ProcessGroupsCheck == processGroupsCheckReject {
+		p.logger.Error("Module reported groups the process does not have", "pid", pid, "groups", missing)
+		return nil, status.Errorf(codes.PermissionDenied, "process %d is not in groups %v", pid, missing)
+	}
+	p.logger.Warn("Dropping groups the process does not have", "pid", pid, "groups", missing)
+
+	checked := *attestationData
+	checked.UserInfo.SystemInfo.SupplementaryGroups = kept
+	return &checked, nil
+}
@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"slices"
+	"testing"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestCheckProcessGroups(t *testing.T) {
+	sudo := domain.GroupInfo{GroupID: "27", GroupName: "sudo"}
+	docker := domain.GroupInfo{GroupID: "999", GroupName: "docker"}
+	contractors := domain.GroupInfo{GroupID: "1500", GroupName: "contractors"}
+
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		pid      int32
+		reported []domain.GroupInfo
+		expected []domain.GroupInfo
+		code     codes.Code
+	}{
+		{name: "groups of the process are kept", mode: "reject", pid: hostPid, reported: []domain.GroupInfo{sudo, docker}, expected: []domain.GroupInfo{sudo, docker}},
+		{name: "no reported group", mode: "reject", pid: hostPid, expected: nil},
+		{name: "intersect drops other groups", mode: "intersect", pid: hostPid, reported: []domain.GroupInfo{sudo, contractors}, expected: []domain.GroupInfo{sudo}},
+		{name: "intersect drops every group", mode: "intersect", pid: containerPid, reported: []domain.GroupInfo{sudo, docker}, expected: []domain.GroupInfo{}},
+		{name: "reject other groups", mode: "reject", pid: hostPid, reported: []domain.GroupInfo{sudo, contractors}, code: codes.PermissionDenied},
+		{name: "groups are compared by id", mode: "reject", pid: hostPid, reported: []domain.GroupInfo{{GroupName: "sudo"}}, code: codes.PermissionDenied},
+		{name: "process without status", mode: "intersect", pid: 1, reported: []domain.GroupInfo{sudo}, code: codes.Internal},
+		{name: "unknown process", mode: "intersect", pid: 9999, reported: []domain.GroupInfo{sudo}, code: codes.Internal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, config := newInspectionTest(t, `process_groups_check = "`+tc.mode+`"`)
+			checked, err := p.checkProcessGroups(config, tc.pid, newAliceAttestation(tc.reported...))
+			if tc.code != codes.OK {
+				requireCode(t, err, tc.code)
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkProcessGroups failed: %v", err)
+			}
+			if groups := checked.UserInfo.SystemInfo.SupplementaryGroups; !slices.Equal(groups, tc.expected) {
+				t.Errorf("expected groups %v, got %v", tc.expected, groups)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"context"
+	"strconv"
+	"wl/plugin/domain"
+
+	"github.com/shirou/gopsutil/v4/common"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+func getProcessInfo(ctx context.Context, procRoot string, pid int32) (domain.ProcessInfo, error) {
+	// gopsutil reads procfs under HOST_PROC, taken from the context so the
+	// configured proc_root applies to this lookup only.
+	ctx = context.WithValue(ctx, common.EnvKey, common.EnvMap{common.HostProcEnvKey: procRoot})
+	// The process is read directly instead of through process.NewProcess,
+	// whose existence check signals the pid when procRoot is not a mount.
+	proc := PSProcessInfo{&process.Process{Pid: pid}}
+
+	name, err := proc.NameWithContext(ctx)
+	if err != nil {
+		return domain.ProcessInfo{}, err
+	}
+	exe, err := proc.ExeWithContext(ctx)
+	if err != nil {
+		return domain.ProcessInfo{}, err
+	}
+	cmdline, err := proc.CmdlineSliceWithContext(ctx)
+	if err != nil {
+		return domain.ProcessInfo{}, err
+	}
+	uids, err := proc.UidsWithContext(ctx)
+	if err != nil {
+		return domain.ProcessInfo{}, err
+	}
+	gids, err := proc.GidsWithContext(ctx)
+	if err != nil {
+		return domain.ProcessInfo{}, err
+	}
+
+	return domain.ProcessInfo{
+		Pid:     pid,
+		Name:    name,
+		Exe:     exe,
+		Cmdline: cmdline,
+		UIDs:    formatIDs(uids),
+		GIDs:    formatIDs(gids),
+	}, nil
+}
+
+func formatIDs(ids []uint32) []string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return formatted
+}
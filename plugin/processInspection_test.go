@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"wl/plugin/domain"
+
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The fake procfs under testdata/proc holds:
+//   - 1: the host init process.
+//   - 4242: a python process alice started with sudo on the host.
+//   - 4343: an app in a rootless docker container of alice.
+//   - 4444: the same python process run by systemd, outside login sessions.
+const (
+	hostPid      = 4242
+	containerPid = 4343
+	daemonPid    = 4444
+)
+
+func newInspectionTest(t *testing.T, extraConfig string) (*Plugin, *Config) {
+	config, err := parseConfig(`
+user_attestation_service_url = "http://127.0.0.1:1"
+proc_root = "testdata/proc"
+etc_root = "testdata/etc"
+` + extraConfig)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	p := new(Plugin)
+	p.SetLogger(hclog.NewNullLogger())
+	return p, config
+}
+
+func newAliceAttestation(groups ...domain.GroupInfo) *domain.UserAttestation {
+	return &domain.UserAttestation{
+		UserInfo: domain.UserInfo{
+			Name: "alice",
+			SystemInfo: domain.SystemInfo{
+				UserID:              "1001",
+				Username:            "alice",
+				GroupID:             "1001",
+				GroupName:           "alice",
+				SupplementaryGroups: groups,
+			},
+		},
+	}
+}
+
+func requireCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
+
+func TestGetProcessInfoUsesProcRoot(t *testing.T) {
+	info, err := getProcessInfo(context.Background(), "testdata/proc", hostPid)
+	if err != nil {
+		t.Fatalf("getProcessInfo failed: %v", err)
+	}
+	if info.Name != "python3" || info.Exe != "/usr/bin/python3.12" {
+		t.Errorf("unexpected process %+v", info)
+	}
+	if !slices.Equal(info.Cmdline, []string{"python3", "/opt/approved/train.py", "--epochs", "3"}) {
+		t.Errorf("unexpected cmdline %q", info.Cmdline)
+	}
+	if !slices.Equal(info.UIDs, []string{"0", "0", "0", "0"}) {
+		t.Errorf("unexpected uids %v", info.UIDs)
+	}
+}
+
+func TestVerifyAccountUsesEtcRoot(t *testing.T) {
+	p, config := newInspectionTest(t, `group_verification = "drop"`)
+
+	attestation := newAliceAttestation(domain.GroupInfo{GroupID: "999"}, domain.GroupInfo{GroupID: "1500"})
+	verified, err := p.verifyAccount(config, attestation)
+	if err != nil {
+		t.Fatalf("verifyAccount failed: %v", err)
+	}
+	if !slices.Equal(verified.UserInfo.SystemInfo.SupplementaryGroups, []domain.GroupInfo{{GroupID: "999", GroupName: "docker"}}) {
+		t.Errorf("unexpected groups %v", verified.UserInfo.SystemInfo.SupplementaryGroups)
+	}
+}
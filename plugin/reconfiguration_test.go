@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+	pb "wl/plugin/infrastructure/userAttestationModule/proto/user_attestor"
+	uasAdptr "wl/plugin/infrastructure/userAuthService"
+
+	"github.com/hashicorp/go-hclog"
+	workloadattestorv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/agent/workloadattestor/v1"
+	configv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/service/common/config/v1"
+	"google.golang.org/grpc"
+)
+
+type staticModuleServer struct {
+	pb.UnimplementedAttestationServiceServer
+	user string
+}
+
+func (server staticModuleServer) GetUserAttestation(ctx context.Context, req *pb.Empty) (*pb.UserAttestation, error) {
+	return &pb.UserAttestation{
+		Token: "token-" + server.user,
+		UserInfo: &pb.UserInfo{
+			Name: server.user,
+			SystemInfo: &pb.SystemInfo{
+				UserId:   "1001",
+				Username: server.user,
+				GroupId:  "1001",
+			},
+		},
+	}, nil
+}
+
+func startStaticModule(t *testing.T, user string) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), user+".sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterAttestationServiceServer(server, staticModuleServer{user: user})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return socketPath
+}
+
+type closingModule struct {
+	closed atomic.Bool
+}
+
+func (module *closingModule) GetUserAttestationData(pid int32, nonce []byte) (*domain.UserAttestation, error) {
+	return &domain.UserAttestation{}, nil
+}
+
+func (module *closingModule) Close() error {
+	module.closed.Store(true)
+	return nil
+}
+
+func TestAttestWhileReconfiguring(t *testing.T) {
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"is_valid": true, "message": "ok"}`)
+	}))
+	defer authService.Close()
+
+	users := []string{"alice", "bob"}
+	configs := make([]string, len(users))
+	for i, user := range users {
+		configs[i] = fmt.Sprintf("user_attestation_service_url = %q\nuser_attestation_module_path = %q\n", authService.URL, startStaticModule(t, user))
+	}
+
+	p := new(Plugin)
+	p.SetLogger(hclog.NewNullLogger())
+	defer p.Close()
+	if _, err := p.Configure(context.Background(), &configv1.ConfigureRequest{HclConfiguration: configs[0]}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				res, err := p.Attest(context.Background(), &workloadattestorv1.AttestRequest{Pid: int32(os.Getpid())})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !slices.Contains(res.SelectorValues, "name:alice") && !slices.Contains(res.SelectorValues, "name:bob") {
+					errs <- fmt.Errorf("unexpected selectors %v", res.SelectorValues)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; ctx.Err() == nil; i++ {
+		if _, err := p.Configure(context.Background(), &configv1.ConfigureRequest{HclConfiguration: configs[i%len(configs)]}); err != nil {
+			t.Fatalf("Configure failed: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Attest failed during reconfiguration: %v", err)
+	}
+}
+
+func TestReplacedAdaptorsAreClosedAfterInFlightAttestations(t *testing.T) {
+	p := new(Plugin)
+	p.SetLogger(hclog.NewNullLogger())
+	defer p.Close()
+
+	config := "user_attestation_service_url = \"http://127.0.0.1:1\"\n"
+	if _, err := p.Configure(context.Background(), &configv1.ConfigureRequest{HclConfiguration: config}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	module := &closingModule{}
+	p.SetUserAttestorModule(module)
+
+	inFlight, err := p.acquireSnapshot()
+	if err != nil {
+		t.Fatalf("acquireSnapshot failed: %v", err)
+	}
+	if _, err := p.Configure(context.Background(), &configv1.ConfigureRequest{HclConfiguration: config}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if inFlight.adaptors.userAttestorModule != module {
+		t.Fatal("expected the in-flight attestation to keep its module")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if module.closed.Load() {
+		t.Fatal("module closed while an attestation was still using it")
+	}
+
+	inFlight.release()
+	deadline := time.Now().Add(time.Second)
+	for !module.closed.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("replaced module was not closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSetAdaptorKeepsSharedAdaptorsOpen(t *testing.T) {
+	p := new(Plugin)
+	p.SetLogger(hclog.NewNullLogger())
+
+	module := &closingModule{}
+	p.SetUserAttestorModule(module)
+	p.SetPolicyEngine(nil)
+	p.SetUserDirectory(nil)
+
+	time.Sleep(50 * time.Millisecond)
+	if module.closed.Load() {
+		t.Fatal("module closed although it is still in use")
+	}
+
+	p.Close()
+	if !module.closed.Load() {
+		t.Fatal("expected Close to close the module")
+	}
+}
+
+func TestReplaceAdaptorPassedByValue(t *testing.T) {
+	p := new(Plugin)
+	p.SetLogger(hclog.NewNullLogger())
+	defer p.Close()
+
+	// The func field makes the adaptor uncomparable.
+	newAdaptor := func() uasAdptr.UserAuthServiceAdaptor {
+		return uasAdptr.UserAuthServiceAdaptor{
+			HTTPClient: &http.Client{},
+			OnExchange: func(uasAdptr.AuthServiceExchange) {},
+		}
+	}
+	p.SetUserAuthService(newAdaptor())
+	p.SetUserAuthService(newAdaptor())
+	replaced := p.snapshot
+	p.SetUserAuthService(newAdaptor())
+
+	// Retired here rather than in the background so that a panic fails the test.
+	p.retireSnapshot(replaced, p.snapshot)
+}
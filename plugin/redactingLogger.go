@@ -0,0 +1,262 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// sensitiveKeySuffixes name the fields whose values never reach the logs,
+// whether they are logger arguments, JSON fields or proto fields. Matching
+// is on the suffix so that e.g. access_token and client_secret are covered.
+var sensitiveKeySuffixes = []string{"token", "secret", "password", "authorization", "signature", "cookie"}
+
+// credentialPattern finds credentials embedded in free text, such as an auth
+// service message or an error quoting a header: bearer and basic credentials,
+// and anything shaped like a JWT.
+var credentialPattern = regexp.MustCompile(`(?i)\b(?:bearer|basic)\s+[A-Za-z0-9._~+/=-]+|\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// redactingLogger removes secrets from the arguments of every log line:
+//   - values of sensitive keys are replaced by a short hash, which still tells
+//     whether two lines are about the same token.
+//   - proto messages, JSON documents and other structured values are logged
+//     as JSON with their sensitive fields hashed.
+//   - credentials embedded in strings and errors are hashed in place.
+type redactingLogger struct {
+	hclog.Logger
+}
+
+// newRedactingLogger wraps logger, unless it already redacts.
+func newRedactingLogger(logger hclog.Logger) hclog.Logger {
+	if logger == nil {
+		return nil
+	}
+	if _, ok := logger.(redactingLogger); ok {
+		return logger
+	}
+	return redactingLogger{Logger: logger}
+}
+
+func (logger redactingLogger) Log(level hclog.Level, msg string, args ...any) {
+	logger.Logger.Log(level, msg, redactArgs(args)...)
+}
+
+func (logger redactingLogger) Trace(msg string, args ...any) {
+	logger.Logger.Trace(msg, redactArgs(args)...)
+}
+
+func (logger redactingLogger) Debug(msg string, args ...any) {
+	logger.Logger.Debug(msg, redactArgs(args)...)
+}
+
+func (logger redactingLogger) Info(msg string, args ...any) {
+	logger.Logger.Info(msg, redactArgs(args)...)
+}
+
+func (logger redactingLogger) Warn(msg string, args ...any) {
+	logger.Logger.Warn(msg, redactArgs(args)...)
+}
+
+func (logger redactingLogger) Error(msg string, args ...any) {
+	logger.Logger.Error(msg, redactArgs(args)...)
+}
+
+func (logger redactingLogger) With(args ...any) hclog.Logger {
+	return redactingLogger{Logger: logger.Logger.With(redactArgs(args)...)}
+}
+
+func (logger redactingLogger) Named(name string) hclog.Logger {
+	return redactingLogger{Logger: logger.Logger.Named(name)}
+}
+
+func (logger redactingLogger) ResetNamed(name string) hclog.Logger {
+	return redactingLogger{Logger: logger.Logger.ResetNamed(name)}
+}
+
+// ImpliedArgs redacts the arguments of a logger that was given them before it
+// was wrapped.
+func (logger redactingLogger) ImpliedArgs() []any {
+	return redactArgs(logger.Logger.ImpliedArgs())
+}
+
+func (logger redactingLogger) GetLevel() hclog.Level {
+	return logger.Logger.GetLevel()
+}
+
+// StandardLogger and StandardWriter are used by libraries logging through the
+// standard log package, whose lines are free text redacted as such.
+func (logger redactingLogger) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	if opts == nil {
+		opts = &hclog.StandardLoggerOptions{}
+	}
+	return log.New(logger.StandardWriter(opts), "", 0)
+}
+
+func (logger redactingLogger) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	return redactingWriter{writer: logger.Logger.StandardWriter(opts)}
+}
+
+type redactingWriter struct {
+	writer io.Writer
+}
+
+// Write reports the length of line rather than of what was written, as the
+// redacted line differs in length.
+func (writer redactingWriter) Write(line []byte) (int, error) {
+	if _, err := io.WriteString(writer.writer, redactText(string(line))); err != nil {
+		return 0, err
+	}
+	return len(line), nil
+}
+
+func redactArgs(args []any) []any {
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		if i%2 == 1 {
+			if key, ok := args[i-1].(string); ok && sensitiveKey(key) {
+				redacted[i] = hashValue(arg)
+				continue
+			}
+		}
+		redacted[i] = redactValue(arg)
+	}
+	return redacted
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashValue replaces a secret by the beginning of its SHA-256.
+func hashValue(value any) string {
+	var content []byte
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if value == "" {
+			return ""
+		}
+		content = []byte(value)
+	case []byte:
+		if len(value) == 0 {
+			return ""
+		}
+		content = value
+	default:
+		content = fmt.Append(nil, value)
+	}
+	hash := sha256.Sum256(content)
+	return "redacted:sha256:" + hex.EncodeToString(hash[:6])
+}
+
+func redactValue(value any) any {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return redactText(value)
+	case json.RawMessage:
+		return redactJSON(value)
+	case proto.Message:
+		content, err := protojson.Marshal(value)
+		if err != nil {
+			return "redacted:unprintable"
+		}
+		return redactJSON(content)
+	case []string:
+		redacted := make([]string, len(value))
+		for i, text := range value {
+			redacted[i] = redactText(text)
+		}
+		return redacted
+	case error:
+		return redactText(value.Error())
+	case fmt.Stringer:
+		return redactText(value.String())
+	}
+
+	// Structures, such as domain types and headers, may hold secrets in any
+	// field, so they are logged as JSON to find them by name.
+	kind := reflect.TypeOf(value).Kind()
+	if kind == reflect.Pointer {
+		kind = reflect.TypeOf(value).Elem().Kind()
+	}
+	if kind == reflect.Struct || kind == reflect.Map || kind == reflect.Interface {
+		content, err := json.Marshal(value)
+		if err != nil {
+			return "redacted:unprintable"
+		}
+		return redactJSON(content)
+	}
+	return value
+}
+
+func redactText(text string) string {
+	return credentialPattern.ReplaceAllStringFunc(text, func(credential string) string {
+		return hashValue(credential)
+	})
+}
+
+// redactSecrets hashes the given secrets wherever they appear in text, for
+// free text from other services that cannot be redacted by field name.
+func redactSecrets(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, hashValue(secret))
+		}
+	}
+	return text
+}
+
+// redactJSON returns the document with its sensitive fields hashed. Documents
+// that cannot be parsed are treated as text.
+func redactJSON(content []byte) string {
+	var document any
+	if err := json.Unmarshal(content, &document); err != nil {
+		return redactText(string(content))
+	}
+	redacted, err := json.Marshal(redactDocument(document))
+	if err != nil {
+		return "redacted:unprintable"
+	}
+	return string(redacted)
+}
+
+func redactDocument(document any) any {
+	switch document := document.(type) {
+	case map[string]any:
+		for key, value := range document {
+			if sensitiveKey(key) {
+				document[key] = hashValue(value)
+				continue
+			}
+			document[key] = redactDocument(value)
+		}
+		return document
+	case []any:
+		for i, value := range document {
+			document[i] = redactDocument(value)
+		}
+		return document
+	case string:
+		return redactText(document)
+	}
+	return document
+}
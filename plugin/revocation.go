@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"wl/plugin/domain"
+	rlAdptr "wl/plugin/infrastructure/revocationList"
+	"wl/plugin/presentation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newRevocationList loads the revocation list and starts refreshing it. A
+// list file that cannot be read fails the configuration, an unreachable URL
+// is retried on the next refresh and attestations fail until it is loaded.
+func (p *Plugin) newRevocationList(config *Config) (*rlAdptr.RevocationListAdaptor, error) {
+	source := config.RevocationListFile + config.RevocationListURL
+	revocationList, err := rlAdptr.NewRevocationListAdaptor(rlAdptr.RevocationListOptions{
+		File:            config.RevocationListFile,
+		URL:             config.RevocationListURL,
+		RefreshInterval: config.revocationRefresh,
+		MaxAge:          config.revocationMaxAge,
+		HTTPClient:      &http.Client{Timeout: config.authServiceTimeout},
+		OnRefresh: func(stats rlAdptr.RevocationListStats, err error) {
+			if err != nil {
+				p.logger.Warn("Failed to refresh the revocation list", "source", source, "age", stats.Age, "error", err)
+				return
+			}
+			p.logger.Debug("Refreshed the revocation list", "source", source, "size", stats.Size)
+		},
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid revocation list: %v", err)
+	}
+	if err := revocationList.Refresh(); err != nil && config.RevocationListFile != "" {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to load revocation list: %v", err)
+	}
+	revocationList.Start()
+	return revocationList, nil
+}
+
+// publishRevocationMetrics exposes the size and the age, in seconds, of the
+// revocation list in use.
+func publishRevocationMetrics(revocationList *rlAdptr.RevocationListAdaptor) {
+	if revocationList == nil {
+		metrics.Delete("revocation_list_size")
+		metrics.Delete("revocation_list_age_seconds")
+		return
+	}
+	metrics.Set("revocation_list_size", expvar.Func(func() any {
+		return revocationList.Stats().Size
+	}))
+	metrics.Set("revocation_list_age_seconds", expvar.Func(func() any {
+		stats := revocationList.Stats()
+		if !stats.Refreshed {
+			return -1
+		}
+		return stats.Age.Seconds()
+	}))
+}
+
+func (p *Plugin) checkRevocation(revocationList presentation.RevocationList, attestationData *domain.UserAttestation) error {
+	revoked, err := revocationList.IsRevoked(attestationData.Token)
+	if errors.Is(err, rlAdptr.ErrStaleRevocationList) || errors.Is(err, rlAdptr.ErrRevocationListNotLoaded) {
+		p.logger.Error("Revocation list is unavailable", "error", err)
+		return status.Errorf(codes.Unavailable, "failed to check token revocation: %v", err)
+	}
+	if err != nil {
+		p.logger.Error("Failed to check token revocation", "error", err)
+		return status.Errorf(codes.Internal, "failed to check token revocation: %v", err)
+	}
+	if revoked {
+		p.logger.Warn("Revoked token presented", "audit", true, "user", attestationData.UserInfo.Name)
+		return status.Error(codes.PermissionDenied, "token has been revoked")
+	}
+	return nil
+}
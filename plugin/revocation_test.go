@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	rlAdptr "wl/plugin/infrastructure/revocationList"
+
+	configv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/service/common/config/v1"
+	"google.golang.org/grpc/codes"
+)
+
+type answeringRevocationList struct {
+	revoked bool
+	err     error
+}
+
+func (list answeringRevocationList) IsRevoked(token string) (bool, error) {
+	return list.revoked, list.err
+}
+
+func TestCheckRevocation(t *testing.T) {
+	p, _ := newInspectionTest(t, "")
+	for _, tc := range []struct {
+		name string
+		list answeringRevocationList
+		code codes.Code
+	}{
+		{name: "not revoked", code: codes.OK},
+		{name: "revoked", list: answeringRevocationList{revoked: true}, code: codes.PermissionDenied},
+		{name: "stale", list: answeringRevocationList{err: rlAdptr.ErrStaleRevocationList}, code: codes.Unavailable},
+		{name: "not loaded", list: answeringRevocationList{err: rlAdptr.ErrRevocationListNotLoaded}, code: codes.Unavailable},
+		{name: "other error", list: answeringRevocationList{err: errors.New("broken")}, code: codes.Internal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requireCode(t, p.checkRevocation(tc.list, newAliceAttestation()), tc.code)
+		})
+	}
+}
+
+// TestFailingConfigureDoesNotServeMetrics checks the metrics server is only
+// started, or replaced, by a configuration that is installed.
+func TestFailingConfigureDoesNotServeMetrics(t *testing.T) {
+	p, _ := newInspectionTest(t, "")
+	defer p.Close()
+
+	address := freeAddress(t)
+	config := fmt.Sprintf("user_attestation_service_url = \"http://127.0.0.1:1\"\nmetrics_address = %q\n", address)
+	_, err := p.Configure(context.Background(), &configv1.ConfigureRequest{
+		HclConfiguration: config + "revocation_list_file = \"testdata/missing.json\"\n",
+	})
+	requireCode(t, err, codes.InvalidArgument)
+	if p.metricsServer != nil {
+		t.Fatal("expected no metrics server after a failing Configure")
+	}
+
+	if _, err := p.Configure(context.Background(), &configv1.ConfigureRequest{HclConfiguration: config}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	_, err = p.Configure(context.Background(), &configv1.ConfigureRequest{
+		HclConfiguration: fmt.Sprintf("user_attestation_service_url = \"http://127.0.0.1:1\"\nmetrics_address = %q\nrevocation_list_file = \"testdata/missing.json\"\n", freeAddress(t)),
+	})
+	requireCode(t, err, codes.InvalidArgument)
+	if p.metricsServer == nil || p.metricsServer.Addr != address {
+		t.Fatal("expected the metrics server of the installed configuration to keep running")
+	}
+}
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestMetricsServeOnlyThePluginMetricsOnLoopback(t *testing.T) {
+	p, _ := newInspectionTest(t, "")
+	defer p.Close()
+
+	_, port, err := net.SplitHostPort(freeAddress(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.serveMetrics(":" + port); err != nil {
+		t.Fatalf("serveMetrics failed: %v", err)
+	}
+	address := net.JoinHostPort("127.0.0.1", port)
+	if p.metricsServer.Addr != address {
+		t.Fatalf("expected the metrics to be served on %s, got %s", address, p.metricsServer.Addr)
+	}
+
+	res, err := http.Get("http://" + address + "/debug/vars")
+	if err != nil {
+		t.Fatalf("failed to get the metrics: %v", err)
+	}
+	defer res.Body.Close()
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&vars); err != nil {
+		t.Fatalf("failed to decode the metrics: %v", err)
+	}
+	if _, ok := vars["user_wl_attestor"]; !ok || len(vars) != 1 {
+		t.Errorf("expected only the plugin metrics, got %v", slices.Collect(maps.Keys(vars)))
+	}
+}
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+)
+
+// selectorKeys are the keys the selector builders may emit, longest first so
+// that a key is not mistaken for a shorter one it starts with.
+var selectorKeys = []string{
+	"system:inner_supplementary_group_id:",
+	"system:supplementary_group_name:",
+	"system:supplementary_group_id:",
+	"system:inner_group_id:",
+	"system:inner_user_id:",
+	"token:expires_bucket:",
+	"system:groupName:",
+	"system:username:",
+	"system:group_id:",
+	"system:user_id:",
+	"secret:",
+	"name:",
+}
+
+// sourceSelectorKeys are the keys emitted after the prefix of a module.
+var sourceSelectorKeys = []string{"username:", "name:"}
+
+// requireWellFormed fails unless every selector is one of keys followed by a
+// non-empty, valid value.
+func requireWellFormed(t *testing.T, selectors []string, keys []string) {
+	t.Helper()
+	for _, selector := range selectors {
+		i := slices.IndexFunc(keys, func(key string) bool { return strings.HasPrefix(selector, key) })
+		if i < 0 {
+			t.Fatalf("selector %q has an unknown key", selector)
+		}
+		value := strings.TrimPrefix(selector, keys[i])
+		if value == "" || !validSelectorValue(value) {
+			t.Fatalf("selector %q has a malformed value", selector)
+		}
+	}
+}
+
+func FuzzBuildSelectors(f *testing.F) {
+	p := new(Plugin)
+	f.Fuzz(func(t *testing.T, name, secret, userID, username, groupID, groupName, supplementaryGroupID, supplementaryGroupName, innerUserID string) {
+		userInfo := domain.UserInfo{
+			Name:   name,
+			Secret: secret,
+			SystemInfo: domain.SystemInfo{
+				UserID:      userID,
+				Username:    username,
+				GroupID:     groupID,
+				GroupName:   groupName,
+				InnerUserID: innerUserID,
+				SupplementaryGroups: []domain.GroupInfo{
+					{GroupID: supplementaryGroupID, GroupName: supplementaryGroupName},
+				},
+			},
+		}
+
+		selectors, err := p.buildSelectors(&userInfo)
+		again, againErr := p.buildSelectors(&userInfo)
+		if (err == nil) != (againErr == nil) || !slices.Equal(selectors, again) {
+			t.Fatalf("unstable output: %v (%v) then %v (%v)", selectors, err, again, againErr)
+		}
+		if err != nil {
+			return
+		}
+		requireWellFormed(t, selectors, selectorKeys)
+
+		sources := []domain.AttestationSource{{Module: "default", SelectorPrefix: "module", UserInfo: userInfo}}
+		sourceSelectors := buildSourceSelectors(sources)
+		if !slices.Equal(sourceSelectors, buildSourceSelectors(sources)) {
+			t.Fatalf("unstable source selectors: %v", sourceSelectors)
+		}
+		for i, selector := range sourceSelectors {
+			rest, ok := strings.CutPrefix(selector, "module:")
+			if !ok {
+				t.Fatalf("selector %q lacks the module prefix", selector)
+			}
+			sourceSelectors[i] = rest
+		}
+		requireWellFormed(t, sourceSelectors, sourceSelectorKeys)
+	})
+}
+
+func FuzzBuildTokenExpirySelectors(f *testing.F) {
+	f.Fuzz(func(t *testing.T, seconds int64) {
+		expiresAt := time.Now().Add(time.Duration(seconds) * time.Second)
+		selectors := buildTokenExpirySelectors(expiresAt)
+		if len(selectors) != 1 {
+			t.Fatalf("expected a single bucket, got %v", selectors)
+		}
+		requireWellFormed(t, selectors, selectorKeys)
+	})
+}
+
+// identitySelectorKeys are the keys of the selectors describing the ssh and
+// directory identities of the user.
+var identitySelectorKeys = []string{"ssh:extension:", "ssh:principal:", "ssh:key_id:", "ldap:group:", "ldap:attr:"}
+
+func FuzzBuildIdentitySelectors(f *testing.F) {
+	f.Add("alice-laptop", "alice", "permit-pty", "", "developers", "mail", "alice@example.com")
+	f.Add("", "alice\nroot", "force-command", "/bin/sh\x00", "\xff", "", "")
+	f.Fuzz(func(t *testing.T, keyID, principal, extension, extensionValue, group, attribute, attributeValue string) {
+		selectors := buildSSHSelectors(&domain.SSHIdentity{
+			KeyID:      keyID,
+			Principals: []string{principal},
+			Extensions: map[string]string{extension: extensionValue},
+		})
+		selectors = append(selectors, buildDirectorySelectors(&domain.DirectoryUser{
+			Groups:     []string{group},
+			Attributes: map[string][]string{attribute: {attributeValue}},
+		})...)
+		requireWellFormed(t, selectors, identitySelectorKeys)
+	})
+}
+
+func TestValidSelectors(t *testing.T) {
+	selectors := []string{"oidc:email:alice@example.com", "oidc:email:", "oidc:name:alice\nroot", "oidc:name:\xff", "policy:degraded"}
+	expected := []string{"oidc:email:alice@example.com", "policy:degraded"}
+	if valid := validSelectors(selectors); !slices.Equal(valid, expected) {
+		t.Errorf("expected %v, got %v", expected, valid)
+	}
+}
@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"wl/plugin/domain"
+	adAdptr "wl/plugin/infrastructure/accountDatabase"
+	pfAdptr "wl/plugin/infrastructure/procfs"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// idRange is an inclusive range of user or group IDs.
+type idRange struct {
+	first, last uint64
+}
+
+func (r idRange) contains(id uint64) bool {
+	return r.first <= id && id <= r.last
+}
+
+func parseIDRanges(name string, values []string) ([]idRange, error) {
+	ranges := make([]idRange, 0, len(values))
+	for _, value := range values {
+		first, last, isRange := strings.Cut(value, "-")
+		if !isRange {
+			last = first
+		}
+		r := idRange{}
+		var err error
+		if r.first, err = strconv.ParseUint(strings.TrimSpace(first), 10, 32); err == nil {
+			r.last, err = strconv.ParseUint(strings.TrimSpace(last), 10, 32)
+		}
+		if err != nil || r.first > r.last {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s entry %q: must be an id or a range like 0-999", name, value)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func inIDRanges(ranges []idRange, id string) bool {
+	parsed, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(ranges, func(r idRange) bool { return r.contains(parsed) })
+}
+
+// attestServiceAccount attests the process from its IDs when it runs as a
+// service account, and returns no attestation to tell the caller to attest a
+// user otherwise. The attestation only describes the account, for the checks
+// that still apply to it such as policies.
+func (p *Plugin) attestServiceAccount(ctx context.Context, config *Config, pid int32) (*domain.UserAttestation, []string, error) {
+	processInfo, err := getProcessInfo(ctx, config.ProcRoot, pid)
+	if err != nil {
+		p.logger.Error("Failed to inspect the attested process", "pid", pid, "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to inspect process %d: %v", pid, err)
+	}
+	// The real and effective IDs must both match, so that neither a setuid
+	// program nor a process that switched only its effective ID qualifies.
+	if len(processInfo.UIDs) < 2 || len(processInfo.GIDs) < 2 {
+		return nil, nil, nil
+	}
+	database := adAdptr.AccountDatabase{EtcDir: config.EtcRoot}
+	if !isServiceAccount(config.ServiceAccounts, database, processInfo) {
+		return nil, nil, nil
+	}
+
+	// A process of a login session was started by a person, e.g. through sudo
+	// or su, and is attested as that user whatever IDs it runs with.
+	procFS := pfAdptr.ProcFS{Root: config.ProcRoot}
+	loginUID, hasLogin, err := procFS.LoginUID(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process login uid", "pid", pid, "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to read login uid of process %d: %v", pid, err)
+	}
+	if hasLogin {
+		p.logger.Debug("Not attesting a login session as a service account", "pid", pid, "user_id", processInfo.UIDs[0], "login_uid", loginUID)
+		return nil, nil, nil
+	}
+
+	groups, err := procFS.SupplementaryGroups(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process groups", "pid", pid, "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to read groups of process %d: %v", pid, err)
+	}
+	attestation := newServiceAccountAttestation(database, processInfo, groups)
+	p.logger.Debug("Attested a service account", "pid", pid, "user_id", processInfo.UIDs[0], "exe", processInfo.Exe)
+	return attestation, buildServiceAccountSelectors(attestation, processInfo), nil
+}
+
+func isServiceAccount(config *ServiceAccountsConfig, database adAdptr.AccountDatabase, processInfo domain.ProcessInfo) bool {
+	matchesUser := func(uid string) bool {
+		if inIDRanges(config.uidRanges, uid) {
+			return true
+		}
+		if len(config.Users) == 0 {
+			return false
+		}
+		account, err := database.LookupUserID(uid)
+		return err == nil && slices.Contains(config.Users, account.Username)
+	}
+	if !matchesUser(processInfo.UIDs[0]) || !matchesUser(processInfo.UIDs[1]) {
+		return false
+	}
+	if len(config.gidRanges) == 0 {
+		return true
+	}
+	return inIDRanges(config.gidRanges, processInfo.GIDs[0]) && inIDRanges(config.gidRanges, processInfo.GIDs[1])
+}
+
+// newServiceAccountAttestation describes the account of the process, named
+// from the passwd and group files when possible.
+func newServiceAccountAttestation(database adAdptr.AccountDatabase, processInfo domain.ProcessInfo, groups []string) *domain.UserAttestation {
+	systemInfo := domain.SystemInfo{UserID: processInfo.UIDs[0], GroupID: processInfo.GIDs[0]}
+	if account, err := database.LookupUserID(systemInfo.UserID); err == nil {
+		systemInfo.Username = account.Username
+	}
+	if group, err := database.LookupGroupID(systemInfo.GroupID); err == nil {
+		systemInfo.GroupName = group.Name
+	}
+	for _, groupID := range groups {
+		group := domain.GroupInfo{GroupID: groupID}
+		if known, err := database.LookupGroupID(groupID); err == nil {
+			group.GroupName = known.Name
+		}
+		systemInfo.SupplementaryGroups = append(systemInfo.SupplementaryGroups, group)
+	}
+	return &domain.UserAttestation{UserInfo: domain.UserInfo{Name: systemInfo.Username, SystemInfo: systemInfo}}
+}
+
+// buildServiceAccountSelectors describes the process with the system
+// selectors of users and its process selectors.
+func buildServiceAccountSelectors(attestation *domain.UserAttestation, processInfo domain.ProcessInfo) []string {
+	systemInfo := attestation.UserInfo.SystemInfo
+	selectors := []string{"mode:service_account"}
+	selectors = appendSelector(selectors, "system:user_id", systemInfo.UserID)
+	selectors = appendSelector(selectors, "system:group_id", systemInfo.GroupID)
+	selectors = appendSelector(selectors, "system:username", systemInfo.Username)
+	selectors = appendSelector(selectors, "system:groupName", systemInfo.GroupName)
+	for _, group := range systemInfo.SupplementaryGroups {
+		selectors = appendSelector(selectors, "system:supplementary_group_id", group.GroupID)
+		selectors = appendSelector(selectors, "system:supplementary_group_name", group.GroupName)
+	}
+	selectors = appendSelector(selectors, "process:name", processInfo.Name)
+	selectors = appendSelector(selectors, "process:exe", processInfo.Exe)
+	return selectors
+}
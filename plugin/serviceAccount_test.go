@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"wl/plugin/domain"
+	adAdptr "wl/plugin/infrastructure/accountDatabase"
+	rlAdptr "wl/plugin/infrastructure/revocationList"
+
+	workloadattestorv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/agent/workloadattestor/v1"
+	"google.golang.org/grpc/codes"
+)
+
+func TestAttestServiceAccount(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   string
+		pid      int32
+		attested bool
+	}{
+		{name: "uid in range", config: `uid_ranges = ["0-999"]`, pid: daemonPid, attested: true},
+		{name: "uid outside the range", config: `uid_ranges = ["0-999"]`, pid: containerPid},
+		{name: "listed user", config: `users = ["root"]`, pid: daemonPid, attested: true},
+		{name: "user not listed", config: `users = ["daemon"]`, pid: daemonPid},
+		{name: "uid without an account", config: `users = ["root"]`, pid: containerPid},
+		{name: "uid and gid in range", config: `uid_ranges = ["0-999"]` + "\n" + `gid_ranges = ["0"]`, pid: daemonPid, attested: true},
+		{name: "uid in range, gid outside", config: `uid_ranges = ["0-999"]` + "\n" + `gid_ranges = ["27"]`, pid: daemonPid},
+		{name: "gid in range, uid outside", config: `uid_ranges = ["0-999"]` + "\n" + `gid_ranges = ["101000"]`, pid: containerPid},
+		// The process alice started with sudo runs as root but belongs to her
+		// login session.
+		{name: "uid in range with another login uid", config: `uid_ranges = ["0-999"]`, pid: hostPid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, config := newInspectionTest(t, "service_accounts {\n"+tc.config+"\n}")
+			attestation, selectors, err := p.attestServiceAccount(context.Background(), config, tc.pid)
+			if err != nil {
+				t.Fatalf("attestServiceAccount failed: %v", err)
+			}
+			if attested := attestation != nil; attested != tc.attested {
+				t.Fatalf("expected attested to be %v, got selectors %v", tc.attested, selectors)
+			}
+			if !tc.attested {
+				return
+			}
+			if systemInfo := attestation.UserInfo.SystemInfo; attestation.UserInfo.Name != "root" || systemInfo.UserID != "0" || len(systemInfo.SupplementaryGroups) != 3 {
+				t.Errorf("unexpected attestation %+v", attestation.UserInfo)
+			}
+			for _, selector := range []string{
+				"mode:service_account",
+				"system:user_id:0",
+				"system:username:root",
+				"system:group_id:0",
+				"system:supplementary_group_name:sudo",
+				"system:supplementary_group_name:docker",
+				"process:exe:/usr/bin/python3.12",
+			} {
+				if !slices.Contains(selectors, selector) {
+					t.Errorf("expected %s in %v", selector, selectors)
+				}
+			}
+		})
+	}
+}
+
+func TestIsServiceAccountNeedsRealAndEffectiveIDs(t *testing.T) {
+	_, config := newInspectionTest(t, "service_accounts {\n"+`uid_ranges = ["0-999"]`+"\n"+`gid_ranges = ["0-999"]`+"\n}")
+	database := adAdptr.AccountDatabase{EtcDir: config.EtcRoot}
+	for _, tc := range []struct {
+		name     string
+		uids     []string
+		gids     []string
+		attested bool
+	}{
+		{name: "service account", uids: []string{"33", "33"}, gids: []string{"33", "33"}, attested: true},
+		{name: "setuid program", uids: []string{"1001", "0"}, gids: []string{"33", "33"}},
+		{name: "switched effective uid", uids: []string{"0", "1001"}, gids: []string{"33", "33"}},
+		{name: "setgid program", uids: []string{"33", "33"}, gids: []string{"1001", "0"}},
+		{name: "user switched to a listed group", uids: []string{"1001", "1001"}, gids: []string{"0", "0"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			processInfo := domain.ProcessInfo{UIDs: tc.uids, GIDs: tc.gids}
+			if attested := isServiceAccount(config.ServiceAccounts, database, processInfo); attested != tc.attested {
+				t.Errorf("expected %v, got %v", tc.attested, attested)
+			}
+		})
+	}
+}
+
+func TestServiceAccountsNeedUsers(t *testing.T) {
+	for _, serviceAccounts := range []string{
+		`gid_ranges = ["0-999"]`,
+		``,
+		`uid_ranges = ["999-0"]`,
+		`uid_ranges = ["0-999"]` + "\n" + `gid_ranges = ["staff"]`,
+	} {
+		_, err := parseConfig(`user_attestation_service_url = "http://127.0.0.1:1"` + "\nservice_accounts {\n" + serviceAccounts + "\n}")
+		requireCode(t, err, codes.InvalidArgument)
+	}
+}
+
+// denyingPolicy denies every attestation and records what it was given.
+type denyingPolicy struct {
+	inputs *[]domain.PolicyInput
+}
+
+func (policy denyingPolicy) Evaluate(input domain.PolicyInput) (domain.PolicyDecision, error) {
+	*policy.inputs = append(*policy.inputs, input)
+	return domain.PolicyDecision{DeniedBy: "deny-all", Message: "denied"}, nil
+}
+
+func TestAttestServiceAccountAppliesChecks(t *testing.T) {
+	serviceAccounts := "service_accounts {\n" + `uid_ranges = ["0-999"]` + "\n}\n"
+	for _, tc := range []struct {
+		name   string
+		config string
+		list   answeringRevocationList
+		policy bool
+		code   codes.Code
+	}{
+		{name: "no check", code: codes.OK},
+		{name: "denied by policy", policy: true, code: codes.PermissionDenied},
+		{name: "unavailable revocation list", list: answeringRevocationList{err: rlAdptr.ErrStaleRevocationList}, code: codes.Unavailable},
+		{name: "shadow enforcement", config: `enforcement = "shadow"`, policy: true, code: codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, config := newInspectionTest(t, serviceAccounts+tc.config)
+			var inputs []domain.PolicyInput
+			p.updateSnapshot(func(next *snapshot) {
+				next.config = config
+				next.adaptors.revocationList = tc.list
+				if tc.policy {
+					next.adaptors.policyEngine = denyingPolicy{inputs: &inputs}
+				}
+			})
+
+			res, err := p.Attest(context.Background(), &workloadattestorv1.AttestRequest{Pid: daemonPid})
+			requireCode(t, err, tc.code)
+			if err == nil && !slices.Contains(res.SelectorValues, "mode:service_account") {
+				t.Errorf("expected a service account, got %v", res.SelectorValues)
+			}
+			if tc.policy && (len(inputs) != 1 || inputs[0].Attestation.UserInfo.SystemInfo.UserID != "0") {
+				t.Errorf("expected the policy to be given the account, got %+v", inputs)
+			}
+		})
+	}
+}
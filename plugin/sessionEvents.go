@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"context"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	sessionEventsMinBackoff = time.Second
+	sessionEventsMaxBackoff = 30 * time.Second
+)
+
+// watchSessionEvents subscribes to the session events of every module that
+// supports streaming until the set is closed.
+func (set *moduleSet) watchSessionEvents(logger hclog.Logger, handle func(module string, event domain.SessionEvent)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	set.stopWatching = cancel
+	for _, member := range set.members {
+		source, ok := member.module.(presentation.SessionEventSource)
+		if !ok {
+			continue
+		}
+		set.watchers.Add(1)
+		go func() {
+			defer set.watchers.Done()
+			set.watchModuleSessionEvents(ctx, logger, member, source, handle)
+		}()
+	}
+}
+
+// watchModuleSessionEvents keeps a session event stream open to a module,
+// reconnecting with an exponential backoff whenever it breaks.
+func (set *moduleSet) watchModuleSessionEvents(ctx context.Context, logger hclog.Logger, member moduleMember, source presentation.SessionEventSource, handle func(module string, event domain.SessionEvent)) {
+	backoff := set.minBackoff
+	for {
+		if negotiator, ok := member.module.(moduleNegotiator); ok {
+			capabilities, err := negotiator.Negotiate()
+			if err == nil && !capabilities.Supports(domain.FeatureStreaming) {
+				logger.Debug("User attestation module does not stream session events", "module", member.name)
+				return
+			}
+			if err != nil {
+				logger.Warn("Failed to negotiate with the user attestation module", "module", member.name, "error", err, "retry_in", backoff)
+			}
+		}
+
+		received := false
+		err := source.WatchSessionEvents(ctx, func(event domain.SessionEvent) {
+			received = true
+			handle(member.name, event)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			backoff = set.minBackoff
+		}
+		logger.Warn("Session event stream interrupted, reconnecting", "module", member.name, "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, set.maxBackoff)
+	}
+}
+
+// handleSessionEvent drops what the plugin cached about a user whose session
+// ended or whose token was replaced, so their identity is not issued from
+// caches anymore.
+func (p *Plugin) handleSessionEvent(module string, event domain.SessionEvent) {
+	p.logger.Info("Session event",
+		"module", module,
+		"type", event.Type,
+		"user", event.UserName,
+		"session_id", event.SessionID,
+	)
+	if !event.EndsAttestations() || event.UserName == "" {
+		return
+	}
+
+	p.configMtx.RLock()
+	current := p.snapshot
+	p.configMtx.RUnlock()
+	if current == nil {
+		return
+	}
+	for _, cache := range current.adaptors.userCaches() {
+		cache.InvalidateUser(event.UserName)
+	}
+	p.logger.Info("Invalidated cached attestations", "audit", true, "module", module, "type", event.Type, "user", event.UserName)
+}
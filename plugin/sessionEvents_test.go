@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+type sessionStream func(ctx context.Context, handle func(domain.SessionEvent)) error
+
+// streamingModule opens its streams in order and, once they are used up,
+// keeps the last one open until it is closed.
+type streamingModule struct {
+	presentation.UserAttestorModule
+	capabilities domain.ModuleCapabilities
+	streams      []sessionStream
+	waiting      chan struct{}
+
+	mtx    sync.Mutex
+	opened int
+}
+
+func newStreamingModule(streams ...sessionStream) *streamingModule {
+	return &streamingModule{
+		capabilities: domain.ModuleCapabilities{ProtocolVersion: 2, Features: []domain.ModuleFeature{domain.FeatureStreaming}},
+		streams:      streams,
+		waiting:      make(chan struct{}),
+	}
+}
+
+func (module *streamingModule) Negotiate() (domain.ModuleCapabilities, error) {
+	return module.capabilities, nil
+}
+
+func (module *streamingModule) WatchSessionEvents(ctx context.Context, handle func(domain.SessionEvent)) error {
+	module.mtx.Lock()
+	i := module.opened
+	module.opened++
+	module.mtx.Unlock()
+
+	if i < len(module.streams) {
+		return module.streams[i](ctx, handle)
+	}
+	if i == len(module.streams) {
+		close(module.waiting)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func brokenStream(events ...domain.SessionEvent) sessionStream {
+	return func(ctx context.Context, handle func(domain.SessionEvent)) error {
+		for _, event := range events {
+			handle(event)
+		}
+		return errors.New("stream broken")
+	}
+}
+
+// recordingCache records the users it was asked to forget.
+type recordingCache struct {
+	presentation.UserAuthService
+	mtx         sync.Mutex
+	invalidated []string
+}
+
+func (cache *recordingCache) InvalidateUser(name string) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	cache.invalidated = append(cache.invalidated, name)
+}
+
+func (cache *recordingCache) users() []string {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	return slices.Clone(cache.invalidated)
+}
+
+func newStreamingSet(module *streamingModule) *moduleSet {
+	return &moduleSet{
+		mode:       modulesModeFirstSuccess,
+		members:    []moduleMember{{name: "laptop", module: module}},
+		minBackoff: time.Millisecond,
+		maxBackoff: 4 * time.Millisecond,
+	}
+}
+
+func waitForStream(t *testing.T, module *streamingModule) {
+	t.Helper()
+	select {
+	case <-module.waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session event stream was not reopened")
+	}
+}
+
+func TestWatchSessionEventsReconnectsWithBackoff(t *testing.T) {
+	logout := domain.SessionEvent{Type: domain.SessionLogout, UserName: "alice"}
+	module := newStreamingModule(brokenStream(), brokenStream(), brokenStream(), brokenStream(), brokenStream(logout), brokenStream())
+	set := newStreamingSet(module)
+
+	logs := new(strings.Builder)
+	logger := hclog.New(&hclog.LoggerOptions{Output: logs, Level: hclog.Warn})
+	var received []domain.SessionEvent
+	set.watchSessionEvents(logger, func(module string, event domain.SessionEvent) {
+		received = append(received, event)
+	})
+	waitForStream(t, module)
+	set.Close()
+
+	// The backoff doubles up to its maximum and starts over once a stream
+	// delivered events.
+	var retries []string
+	for _, match := range regexp.MustCompile(`retry_in=(\S+)`).FindAllStringSubmatch(logs.String(), -1) {
+		retries = append(retries, match[1])
+	}
+	expected := []string{"1ms", "2ms", "4ms", "4ms", "1ms", "2ms"}
+	if !slices.Equal(retries, expected) {
+		t.Errorf("expected retries after %v, got %v", expected, retries)
+	}
+	if !slices.Equal(received, []domain.SessionEvent{logout}) {
+		t.Errorf("expected the logout event, got %v", received)
+	}
+}
+
+func TestWatchSessionEventsSkipsModulesWithoutStreaming(t *testing.T) {
+	module := newStreamingModule()
+	module.capabilities.Features = nil
+	set := newStreamingSet(module)
+
+	set.watchSessionEvents(hclog.NewNullLogger(), func(string, domain.SessionEvent) {})
+	set.Close()
+	if module.opened != 0 {
+		t.Errorf("expected no stream to be opened, got %d", module.opened)
+	}
+}
+
+func TestHandleSessionEventInvalidatesCaches(t *testing.T) {
+	for _, tc := range []struct {
+		event       domain.SessionEvent
+		invalidated []string
+	}{
+		{event: domain.SessionEvent{Type: domain.SessionLogout, UserName: "alice"}, invalidated: []string{"alice"}},
+		{event: domain.SessionEvent{Type: domain.SessionLock, UserName: "alice"}, invalidated: []string{"alice"}},
+		{event: domain.SessionEvent{Type: domain.SessionTokenRotation, UserName: "alice"}, invalidated: []string{"alice"}},
+		{event: domain.SessionEvent{Type: domain.SessionLogin, UserName: "alice"}},
+		{event: domain.SessionEvent{Type: domain.SessionUnlock, UserName: "alice"}},
+		{event: domain.SessionEvent{Type: domain.SessionLogout}},
+	} {
+		t.Run(string(tc.event.Type), func(t *testing.T) {
+			p, config := newInspectionTest(t, "")
+			cache := &recordingCache{}
+			p.updateSnapshot(func(next *snapshot) {
+				next.config = config
+				next.adaptors.userAuthService = cache
+			})
+
+			p.handleSessionEvent("laptop", tc.event)
+			if users := cache.users(); !slices.Equal(users, tc.invalidated) {
+				t.Errorf("expected %v to be invalidated, got %v", tc.invalidated, users)
+			}
+		})
+	}
+}
+
+func TestHandleSessionEventWithoutSnapshot(t *testing.T) {
+	p, _ := newInspectionTest(t, "")
+	p.handleSessionEvent("laptop", domain.SessionEvent{Type: domain.SessionLogout, UserName: "alice"})
+}
+
+// TestSessionEventsInvalidateInstalledSnapshot streams a logout to a plugin
+// and checks the caches of the snapshot in use are the ones invalidated.
+func TestSessionEventsInvalidateInstalledSnapshot(t *testing.T) {
+	p, config := newInspectionTest(t, "")
+	previous, current := &recordingCache{}, &recordingCache{}
+	p.updateSnapshot(func(next *snapshot) {
+		next.config = config
+		next.adaptors.userAuthService = previous
+	})
+	p.updateSnapshot(func(next *snapshot) {
+		next.adaptors.userAuthService = current
+	})
+
+	module := newStreamingModule(brokenStream(domain.SessionEvent{Type: domain.SessionLogout, UserName: "alice"}))
+	set := newStreamingSet(module)
+	set.watchSessionEvents(hclog.NewNullLogger(), p.handleSessionEvent)
+	waitForStream(t, module)
+	set.Close()
+
+	if users := current.users(); !slices.Equal(users, []string{"alice"}) {
+		t.Errorf("expected alice to be invalidated, got %v", users)
+	}
+	if users := previous.users(); len(users) > 0 {
+		t.Errorf("expected the replaced snapshot to be left alone, got %v", users)
+	}
+}
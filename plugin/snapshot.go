@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"io"
+	"reflect"
+	"slices"
+	"sync"
+	"wl/plugin/presentation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type adaptors struct {
+	userAttestorModule presentation.UserAttestorModule
+	userAuthService    presentation.UserAuthService
+	policyEngine       presentation.PolicyEngine
+	userDirectory      presentation.UserDirectory
+	revocationList     presentation.RevocationList
+}
+
+// closers returns the adaptors that hold connections.
+func (a adaptors) closers() []io.Closer {
+	closers := []io.Closer{}
+	for _, adaptor := range []any{a.userAttestorModule, a.userAuthService, a.policyEngine, a.userDirectory, a.revocationList} {
+		if closer, ok := adaptor.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+	}
+	return closers
+}
+
+// userCaches returns the adaptors keeping results per user.
+func (a adaptors) userCaches() []presentation.UserCache {
+	caches := []presentation.UserCache{}
+	for _, adaptor := range []any{a.userAttestorModule, a.userAuthService, a.policyEngine, a.userDirectory, a.revocationList} {
+		if cache, ok := adaptor.(presentation.UserCache); ok {
+			caches = append(caches, cache)
+		}
+	}
+	return caches
+}
+
+// snapshot is a configuration together with the adaptors built from it. It is
+// never modified once installed: Configure and the Set* methods install a new
+// one, and an attestation keeps using the snapshot it started with.
+type snapshot struct {
+	config   *Config
+	adaptors adaptors
+	inFlight sync.WaitGroup
+}
+
+// acquireSnapshot returns the current snapshot, which the caller must release
+// when done with it.
+func (p *Plugin) acquireSnapshot() (*snapshot, error) {
+	p.configMtx.RLock()
+	defer p.configMtx.RUnlock()
+	if p.snapshot == nil || p.snapshot.config == nil {
+		return nil, status.Error(codes.FailedPrecondition, "not configured")
+	}
+	p.snapshot.inFlight.Add(1)
+	return p.snapshot, nil
+}
+
+func (s *snapshot) release() {
+	s.inFlight.Done()
+}
+
+// updateSnapshot installs a copy of the current snapshot changed by update and
+// retires the previous one in the background.
+func (p *Plugin) updateSnapshot(update func(next *snapshot)) {
+	p.configMtx.Lock()
+	previous := p.snapshot
+	next := &snapshot{}
+	if previous != nil {
+		next.config = previous.config
+		next.adaptors = previous.adaptors
+	}
+	update(next)
+	p.snapshot = next
+	p.configMtx.Unlock()
+
+	if previous != nil {
+		go p.retireSnapshot(previous, next)
+	}
+}
+
+// retireSnapshot waits for the attestations still using a replaced snapshot
+// and then closes the adaptors its successor does not reuse.
+func (p *Plugin) retireSnapshot(retired, successor *snapshot) {
+	retired.inFlight.Wait()
+
+	kept := []io.Closer{}
+	if successor != nil {
+		kept = successor.adaptors.closers()
+	}
+	for _, closer := range retired.adaptors.closers() {
+		if slices.ContainsFunc(kept, func(other io.Closer) bool { return sameAdaptor(closer, other) }) {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			p.logger.Warn("Failed to close a replaced adaptor", "error", err)
+		}
+	}
+}
+
+// sameAdaptor tells whether two closers may be the same adaptor. Adaptors
+// passed by value with uncomparable fields, e.g. a func, cannot be told apart
+// and are taken to be the same when their types match, so that an adaptor
+// still in use is never closed.
+func sameAdaptor(a, b io.Closer) bool {
+	typeA, typeB := reflect.TypeOf(a), reflect.TypeOf(b)
+	if typeA != typeB {
+		return false
+	}
+	if !typeA.Comparable() {
+		return true
+	}
+	return a == b
+}
+
+// closeAdaptors closes adaptors that were never installed in a snapshot.
+func (p *Plugin) closeAdaptors(unused adaptors) {
+	for _, closer := range unused.closers() {
+		if err := closer.Close(); err != nil {
+			p.logger.Warn("Failed to close an unused adaptor", "error", err)
+		}
+	}
+}
+
+// Close waits for the running attestations and closes all adaptors. It is
+// called by the plugin framework when the plugin is unloaded.
+func (p *Plugin) Close() error {
+	p.configMtx.Lock()
+	current := p.snapshot
+	p.snapshot = nil
+	p.configMtx.Unlock()
+
+	if current != nil {
+		p.retireSnapshot(current, nil)
+	}
+	p.stopMetrics()
+	return nil
+}
@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"sort"
+	"wl/plugin/domain"
+	scAdptr "wl/plugin/infrastructure/sshCertificate"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const nonceSize = 32
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// getSSHSelectors verifies the SSH certificate returned by the module, if any,
+// and describes the identity it carries.
+func (p *Plugin) getSSHSelectors(config *Config, nonce []byte, attestationData *domain.UserAttestation) ([]string, error) {
+	if attestationData.SSHCertificate == "" {
+		if config.RequireSSHCertificate {
+			p.logger.Error("Module did not return an ssh certificate", "user", attestationData.UserInfo.Name)
+			return nil, status.Error(codes.PermissionDenied, "an ssh certificate is required")
+		}
+		return nil, nil
+	}
+
+	principal := ""
+	if config.SSHPrincipalMatch {
+		principal = attestationData.UserInfo.SystemInfo.Username
+	}
+	verifier := scAdptr.SSHCertificateVerifier{CAKeys: config.sshCAKeys}
+	identity, err := verifier.Verify(attestationData.SSHCertificate, attestationData.SSHSignature, nonce, principal)
+	if err != nil {
+		p.logger.Error("Failed to verify the ssh certificate", "user", attestationData.UserInfo.Name, "error", err)
+		return nil, status.Errorf(codes.PermissionDenied, "failed to verify ssh certificate: %v", err)
+	}
+	return buildSSHSelectors(identity), nil
+}
+
+func buildSSHSelectors(identity *domain.SSHIdentity) []string {
+	selectors := appendSelector([]string{}, "ssh:key_id", identity.KeyID)
+	for _, principal := range identity.Principals {
+		selectors = appendSelector(selectors, "ssh:principal", principal)
+	}
+
+	extensions := make([]string, 0, len(identity.Extensions))
+	for extension := range identity.Extensions {
+		extensions = append(extensions, extension)
+	}
+	sort.Strings(extensions)
+	for _, extension := range extensions {
+		if value := identity.Extensions[extension]; value != "" {
+			selectors = appendSelector(selectors, "ssh:extension", extension, value)
+		} else {
+			selectors = appendSelector(selectors, "ssh:extension", extension)
+		}
+	}
+	return selectors
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"time"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tokenExpiryBuckets are the upper bounds of the token:expires_bucket
+// selector values, coarse enough for registration entries to match on.
+var tokenExpiryBuckets = []struct {
+	limit time.Duration
+	name  string
+}{
+	{15 * time.Minute, "lt_15m"},
+	{time.Hour, "lt_1h"},
+	{8 * time.Hour, "lt_8h"},
+	{24 * time.Hour, "lt_24h"},
+}
+
+// tokenExpiry is the earliest expiry reported by the module or the
+// validators, zero when none of them knows it.
+func tokenExpiry(attestationData *domain.UserAttestation, attestationResult domain.UserAttestationValidation) time.Time {
+	return domain.EarlierExpiry(attestationData.TokenExpiresAt, attestationResult.ExpiresAt)
+}
+
+// checkTokenExpiry rejects tokens that expire within the configured margin,
+// so no SVID is issued for a credential about to end.
+func (p *Plugin) checkTokenExpiry(config *Config, expiresAt time.Time, user string) error {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	remaining := time.Until(expiresAt)
+	if remaining <= config.tokenExpiryMargin {
+		p.logger.Warn("Token expires too soon", "audit", true, "user", user, "expires_at", expiresAt, "margin", config.tokenExpiryMargin)
+		return status.Errorf(codes.PermissionDenied, "token expires at %s, within the %s margin", expiresAt.Format(time.RFC3339), config.tokenExpiryMargin)
+	}
+	return nil
+}
+
+func buildTokenExpirySelectors(expiresAt time.Time) []string {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	remaining := time.Until(expiresAt)
+	for _, bucket := range tokenExpiryBuckets {
+		if remaining < bucket.limit {
+			return []string{"token:expires_bucket:" + bucket.name}
+		}
+	}
+	return []string{"token:expires_bucket:ge_24h"}
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"slices"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestCheckTokenExpiry(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		margin    string
+		expiresIn time.Duration
+		missing   bool
+		code      codes.Code
+	}{
+		{name: "beyond the margin", margin: "5m", expiresIn: time.Hour, code: codes.OK},
+		{name: "within the margin", margin: "5m", expiresIn: 4 * time.Minute, code: codes.PermissionDenied},
+		{name: "at the margin", margin: "5m", expiresIn: 5 * time.Minute, code: codes.PermissionDenied},
+		{name: "expired without a margin", expiresIn: -time.Second, code: codes.PermissionDenied},
+		{name: "valid without a margin", expiresIn: time.Minute, code: codes.OK},
+		{name: "no expiry with a margin", margin: "5m", missing: true, code: codes.OK},
+		{name: "no expiry without a margin", missing: true, code: codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			extraConfig := ""
+			if tc.margin != "" {
+				extraConfig = `token_expiry_margin = "` + tc.margin + `"`
+			}
+			p, config := newInspectionTest(t, extraConfig)
+
+			var expiresAt time.Time
+			if !tc.missing {
+				expiresAt = time.Now().Add(tc.expiresIn)
+			}
+			requireCode(t, p.checkTokenExpiry(config, expiresAt, "alice"), tc.code)
+		})
+	}
+}
+
+func TestTokenExpiryUsesTheEarliestExpiry(t *testing.T) {
+	soon := time.Now().Add(time.Minute)
+	later := time.Now().Add(time.Hour)
+	for _, tc := range []struct {
+		name      string
+		module    time.Time
+		validator time.Time
+		expected  time.Time
+	}{
+		{name: "module only", module: later, expected: later},
+		{name: "validator only", validator: soon, expected: soon},
+		{name: "validator earlier", module: later, validator: soon, expected: soon},
+		{name: "module earlier", module: soon, validator: later, expected: soon},
+		{name: "neither"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attestation := &domain.UserAttestation{TokenExpiresAt: tc.module}
+			if expiry := tokenExpiry(attestation, domain.UserAttestationValidation{ExpiresAt: tc.validator}); !expiry.Equal(tc.expected) {
+				t.Errorf("expected %s, got %s", tc.expected, expiry)
+			}
+		})
+	}
+}
+
+func TestBuildTokenExpirySelectors(t *testing.T) {
+	for _, tc := range []struct {
+		expiresIn time.Duration
+		bucket    string
+	}{
+		{expiresIn: 10 * time.Minute, bucket: "lt_15m"},
+		{expiresIn: 30 * time.Minute, bucket: "lt_1h"},
+		{expiresIn: 2 * time.Hour, bucket: "lt_8h"},
+		{expiresIn: 12 * time.Hour, bucket: "lt_24h"},
+		{expiresIn: 48 * time.Hour, bucket: "ge_24h"},
+	} {
+		selectors := buildTokenExpirySelectors(time.Now().Add(tc.expiresIn))
+		if expected := []string{"token:expires_bucket:" + tc.bucket}; !slices.Equal(selectors, expected) {
+			t.Errorf("expected %v for %s, got %v", expected, tc.expiresIn, selectors)
+		}
+	}
+	if selectors := buildTokenExpirySelectors(time.Time{}); selectors != nil {
+		t.Errorf("expected no selector without an expiry, got %v", selectors)
+	}
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"wl/plugin/domain"
+	pfAdptr "wl/plugin/infrastructure/procfs"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// translateNamespaceIDs makes the user and group IDs of the attestation host
+// IDs, so every later check compares like with like, and records the IDs seen
+// inside the user namespace of the process next to them.
+func (p *Plugin) translateNamespaceIDs(config *Config, pid int32, attestationData *domain.UserAttestation) (*domain.UserAttestation, error) {
+	procFS := pfAdptr.ProcFS{Root: config.ProcRoot}
+	uidMap, err := procFS.UIDMap(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process uid map", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read uid map of process %d: %v", pid, err)
+	}
+	gidMap, err := procFS.GIDMap(pid)
+	if err != nil {
+		p.logger.Error("Failed to read the process gid map", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to read gid map of process %d: %v", pid, err)
+	}
+	if uidMap.IsIdentity() && gidMap.IsIdentity() {
+		return attestationData, nil
+	}
+
+	translated := *attestationData
+	systemInfo := &translated.UserInfo.SystemInfo
+	reported := attestationData.UserInfo.SystemInfo
+
+	translate := func(idMap pfAdptr.IDMap, id string) (string, string, error) {
+		if id == "" {
+			return "", "", nil
+		}
+		if config.UserNamespaceIDs == userNamespaceIDsProcess {
+			host, err := idMap.ToHost(id)
+			return host, id, err
+		}
+		inner, err := idMap.ToInner(id)
+		return id, inner, err
+	}
+
+	if systemInfo.UserID, systemInfo.InnerUserID, err = translate(uidMap, reported.UserID); err != nil {
+		return nil, p.namespaceIDError(pid, "user", err)
+	}
+	if systemInfo.GroupID, systemInfo.InnerGroupID, err = translate(gidMap, reported.GroupID); err != nil {
+		return nil, p.namespaceIDError(pid, "group", err)
+	}
+	systemInfo.SupplementaryGroups = make([]domain.GroupInfo, len(reported.SupplementaryGroups))
+	for i, group := range reported.SupplementaryGroups {
+		systemInfo.SupplementaryGroups[i] = group
+		if systemInfo.SupplementaryGroups[i].GroupID, systemInfo.SupplementaryGroups[i].InnerGroupID, err = translate(gidMap, group.GroupID); err != nil {
+			return nil, p.namespaceIDError(pid, "supplementary group", err)
+		}
+	}
+	return &translated, nil
+}
+
+func (p *Plugin) namespaceIDError(pid int32, kind string, err error) error {
+	p.logger.Error("Module reported an id outside the user namespace of the process", "pid", pid, "kind", kind, "error", err)
+	return status.Errorf(codes.PermissionDenied, "invalid %s id for the user namespace of process %d: %v", kind, pid, err)
+}
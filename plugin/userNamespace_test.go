@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"testing"
+	"wl/plugin/domain"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestTranslateNamespaceIDs(t *testing.T) {
+	p, config := newInspectionTest(t, `user_namespace_ids = "process"`)
+
+	translated, err := p.translateNamespaceIDs(config, containerPid, newAliceAttestation(domain.GroupInfo{GroupID: "0", GroupName: "root"}))
+	if err != nil {
+		t.Fatalf("translateNamespaceIDs failed: %v", err)
+	}
+	systemInfo := translated.UserInfo.SystemInfo
+	if systemInfo.UserID != "101000" || systemInfo.InnerUserID != "1001" {
+		t.Errorf("unexpected user ids %q/%q", systemInfo.UserID, systemInfo.InnerUserID)
+	}
+	if systemInfo.GroupID != "101000" || systemInfo.InnerGroupID != "1001" {
+		t.Errorf("unexpected group ids %q/%q", systemInfo.GroupID, systemInfo.InnerGroupID)
+	}
+	if group := systemInfo.SupplementaryGroups[0]; group.GroupID != "1001" || group.InnerGroupID != "0" {
+		t.Errorf("unexpected supplementary group %+v", group)
+	}
+
+	unchanged, err := p.translateNamespaceIDs(config, hostPid, newAliceAttestation())
+	if err != nil {
+		t.Fatalf("translateNamespaceIDs failed: %v", err)
+	}
+	if unchanged.UserInfo.SystemInfo.InnerUserID != "" {
+		t.Errorf("expected no translation in the host namespace, got %+v", unchanged.UserInfo.SystemInfo)
+	}
+}
+
+func TestTranslateNamespaceIDsFromHost(t *testing.T) {
+	p, config := newInspectionTest(t, `user_namespace_ids = "host"`)
+
+	attestation := newAliceAttestation(domain.GroupInfo{GroupID: "1001", GroupName: "alice"})
+	attestation.UserInfo.SystemInfo.UserID = "101000"
+	attestation.UserInfo.SystemInfo.GroupID = "101000"
+	translated, err := p.translateNamespaceIDs(config, containerPid, attestation)
+	if err != nil {
+		t.Fatalf("translateNamespaceIDs failed: %v", err)
+	}
+	systemInfo := translated.UserInfo.SystemInfo
+	if systemInfo.UserID != "101000" || systemInfo.InnerUserID != "1001" || systemInfo.GroupID != "101000" || systemInfo.InnerGroupID != "1001" {
+		t.Errorf("unexpected ids %+v", systemInfo)
+	}
+	if group := systemInfo.SupplementaryGroups[0]; group.GroupID != "1001" || group.InnerGroupID != "0" {
+		t.Errorf("unexpected supplementary group %+v", group)
+	}
+	if attestation.UserInfo.SystemInfo.InnerUserID != "" || attestation.UserInfo.SystemInfo.SupplementaryGroups[0].InnerGroupID != "" {
+		t.Error("expected the reported attestation to be left unchanged")
+	}
+}
+
+func TestTranslateNamespaceIDsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mode   string
+		change func(systemInfo *domain.SystemInfo)
+		code   codes.Code
+	}{
+		{
+			name:   "host user outside the namespace",
+			mode:   "host",
+			change: func(systemInfo *domain.SystemInfo) { systemInfo.UserID = "0" },
+			code:   codes.PermissionDenied,
+		},
+		{
+			name:   "inner group outside the namespace",
+			mode:   "process",
+			change: func(systemInfo *domain.SystemInfo) { systemInfo.GroupID = "70000" },
+			code:   codes.PermissionDenied,
+		},
+		{
+			name: "supplementary group outside the namespace",
+			mode: "process",
+			change: func(systemInfo *domain.SystemInfo) {
+				systemInfo.SupplementaryGroups = []domain.GroupInfo{{GroupID: "65537"}}
+			},
+			code: codes.PermissionDenied,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, config := newInspectionTest(t, `user_namespace_ids = "`+tc.mode+`"`)
+			attestation := newAliceAttestation()
+			tc.change(&attestation.UserInfo.SystemInfo)
+			_, err := p.translateNamespaceIDs(config, containerPid, attestation)
+			requireCode(t, err, tc.code)
+		})
+	}
+
+	p, config := newInspectionTest(t, `user_namespace_ids = "process"`)
+	_, err := p.translateNamespaceIDs(config, 9999, newAliceAttestation())
+	requireCode(t, err, codes.Internal)
+
+	config.ProcRoot = writeProcess(t, containerPid, map[string]string{"uid_map": "0 0 4294967295\n"})
+	_, err = p.translateNamespaceIDs(config, containerPid, newAliceAttestation())
+	requireCode(t, err, codes.Internal)
+}
@@ -2,8 +2,18 @@ package plugin
 
 import (
 	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 	"wl/plugin/domain"
+	adAdptr "wl/plugin/infrastructure/accountDatabase"
+	ovAdptr "wl/plugin/infrastructure/oidcValidator"
+	peAdptr "wl/plugin/infrastructure/policyEngine"
+	rlAdptr "wl/plugin/infrastructure/revocationList"
 	uamAdptr "wl/plugin/infrastructure/userAttestationModule"
 	uasAdptr "wl/plugin/infrastructure/userAuthService"
 	"wl/plugin/presentation"
@@ -19,6 +29,7 @@ import (
 
 var (
 	_ pluginsdk.NeedsLogger = (*Plugin)(nil)
+	_ io.Closer             = (*Plugin)(nil)
 )
 
 type PSProcessInfo struct {
@@ -28,33 +39,146 @@ type PSProcessInfo struct {
 type Plugin struct {
 	workloadattestorv1.UnimplementedWorkloadAttestorServer
 	configv1.UnimplementedConfigServer
-	configMtx          sync.RWMutex
-	config             *Config
-	logger             hclog.Logger
-	userAttestorModule presentation.UserAttestorModule
-	userAuthService    presentation.UserAuthService
+	configMtx sync.RWMutex
+	snapshot  *snapshot
+	logger    hclog.Logger
+
+	metricsMtx    sync.Mutex
+	metricsServer *http.Server
 }
 
 func (p *Plugin) Attest(ctx context.Context, req *workloadattestorv1.AttestRequest) (*workloadattestorv1.AttestResponse, error) {
-	config, err := p.getConfig()
+	snapshot, err := p.acquireSnapshot()
 	if err != nil {
 		p.logger.Error("Failed to get the configuration", "error", err)
 		return nil, err
 	}
+	defer snapshot.release()
+	config, adaptors := snapshot.config, snapshot.adaptors
 
-	p.SetUserAttestorModule(uamAdptr.UserAttestorModuleAdaptor{SocketPath: config.UserAttestationModuleSocketPath})
-	p.SetUserAuthService(uasAdptr.UserAuthServiceAdaptor{ServiceURL: config.UserAttestationServiceURL})
+	nonce, err := newNonce()
+	if err != nil {
+		p.logger.Error("Failed to generate a nonce", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to generate a nonce: %v", err)
+	}
+
+	enforcer := p.newEnforcer(config, req.Pid)
+	defer enforcer.done()
+
+	if config.RequireHostNamespaces {
+		if err := enforcer.check(p.checkHostNamespaces(config, req.Pid)); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ServiceAccounts != nil {
+		serviceAccount, selectors, err := p.attestServiceAccount(ctx, config, req.Pid)
+		if err != nil {
+			return nil, err
+		}
+		if serviceAccount != nil {
+			// Service accounts have no token, but an unavailable revocation
+			// list still fails them as it fails users.
+			if adaptors.revocationList != nil {
+				if err := enforcer.check(p.checkRevocation(adaptors.revocationList, serviceAccount)); err != nil {
+					return nil, err
+				}
+			}
+			if adaptors.policyEngine != nil {
+				policySelectors, err := p.applyPolicies(ctx, config, adaptors.policyEngine, req.Pid, serviceAccount, domain.UserAttestationValidation{}, selectors)
+				if err := enforcer.check(err); err != nil {
+					return nil, err
+				}
+				if err == nil {
+					selectors = policySelectors
+				}
+			}
+			return &workloadattestorv1.AttestResponse{SelectorValues: selectors}, nil
+		}
+	}
 
 	// 1. Communicate with user attestor module to get data
-	attestationData, err := p.userAttestorModule.GetUserAttestationData()
+	attestationData, err := adaptors.userAttestorModule.GetUserAttestationData(req.Pid, nonce)
+	var conflictErr *moduleConflictError
+	if errors.As(err, &conflictErr) {
+		p.logger.Warn("Attestation modules disagree on the user", "audit", true, "pid", req.Pid, "error", err)
+		return nil, status.Errorf(codes.PermissionDenied, "conflicting attestation data: %v", err)
+	}
+	if errors.Is(err, uamAdptr.ErrIncompatibleModule) {
+		p.logger.Error("Incompatible user attestation module", "error", err)
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to get attestation data: %v", err)
+	}
 	if err != nil {
 		p.logger.Error("Failed to get attestation data", "error", err)
+		return nil, status.Errorf(codes.Unavailable, "failed to get attestation data: %v", err)
+	}
+	attestationData.Nonce = nonce
+	if err := enforcer.check(p.validateAttestation(req.Pid, attestationData)); err != nil {
 		return nil, err
 	}
+	// In shadow mode a step that fails leaves the data as it was.
+	if config.UserNamespaceIDs != userNamespaceIDsOff {
+		translated, err := p.translateNamespaceIDs(config, req.Pid, attestationData)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		if err == nil {
+			attestationData = translated
+		}
+	}
+	if config.GroupVerification != groupVerificationOff {
+		verified, err := p.verifyAccount(config, attestationData)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		if err == nil {
+			attestationData = verified
+		}
+	}
+	if config.ProcessGroupsCheck != processGroupsCheckOff {
+		checked, err := p.checkProcessGroups(config, req.Pid, attestationData)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		if err == nil {
+			attestationData = checked
+		}
+	}
+	// Checked before the auth service, whose outages may be bridged by
+	// cached validations of the same token.
+	if adaptors.revocationList != nil {
+		if err := enforcer.check(p.checkRevocation(adaptors.revocationList, attestationData)); err != nil {
+			return nil, err
+		}
+	}
 	// 2. Communicate with user auth service to validate token and data
-	attestationResult, err := p.userAuthService.ValidateData(attestationData)
-	if err != nil || !attestationResult.IsValid {
-		p.logger.Error("Failed to validate data "+attestationResult.Message, "error", err)
+	attestationResult, validationErr := adaptors.userAuthService.ValidateData(attestationData)
+	if validationErr != nil {
+		p.logger.Error("Failed to validate data", "error", validationErr)
+		err := status.Errorf(codes.Unavailable, "failed to validate attestation data: %v", validationErr)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+	}
+	// The message comes from the auth service, which may quote what it was
+	// sent, and is both logged and returned to the agent.
+	attestationResult.Message = redactSecrets(attestationResult.Message, attestationData.Token, attestationData.UserInfo.Secret)
+	if validationErr == nil && !attestationResult.IsValid {
+		p.logger.Error("Attestation data rejected", "reason", attestationResult.Message)
+		err := status.Errorf(codes.PermissionDenied, "attestation data rejected: %s", attestationResult.Message)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+	}
+	if attestationResult.Degraded {
+		p.logger.Warn("Attestation admitted with degraded validation",
+			"audit", true,
+			"user", attestationData.UserInfo.Name,
+			"reason", attestationResult.Message,
+		)
+	}
+	expiresAt := tokenExpiry(attestationData, attestationResult)
+	if err := enforcer.check(p.checkTokenExpiry(config, expiresAt, attestationData.UserInfo.Name)); err != nil {
 		return nil, err
 	}
 	// 3. return selectors
@@ -63,13 +187,59 @@ func (p *Plugin) Attest(ctx context.Context, req *workloadattestorv1.AttestReque
 		p.logger.Error("Failed to build selectors", "error", err)
 		return nil, err
 	}
+	selectors = append(selectors, buildTokenExpirySelectors(expiresAt)...)
+	selectors = append(selectors, buildSourceSelectors(attestationData.Sources)...)
+	selectors = append(selectors, validSelectors(attestationResult.Selectors)...)
+	if attestationResult.Degraded {
+		selectors = append(selectors, "validation:degraded")
+	}
+	if len(config.sshCAKeys) > 0 {
+		sshSelectors, err := p.getSSHSelectors(config, nonce, attestationData)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sshSelectors...)
+	}
+	if config.ContainerSelectors {
+		containerSelectors, err := p.getContainerSelectors(config, req.Pid)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, containerSelectors...)
+	}
+	if config.LoginSelectors || config.RequireLoginUserMatch {
+		loginSelectors, err := p.getLoginSelectors(config, req.Pid, attestationData)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		if config.LoginSelectors {
+			selectors = append(selectors, loginSelectors...)
+		}
+	}
+	if adaptors.userDirectory != nil {
+		directorySelectors, err := p.getDirectorySelectors(adaptors.userDirectory, attestationData.UserInfo.Name, config.LDAP != nil && config.LDAP.Required)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, directorySelectors...)
+	}
+	// 4. apply attestation policies
+	if adaptors.policyEngine != nil {
+		policySelectors, err := p.applyPolicies(ctx, config, adaptors.policyEngine, req.Pid, attestationData, attestationResult, selectors)
+		if err := enforcer.check(err); err != nil {
+			return nil, err
+		}
+		if err == nil {
+			selectors = policySelectors
+		}
+	}
 
 	return &workloadattestorv1.AttestResponse{
 		SelectorValues: selectors,
 	}, nil
 }
 
-func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest) (*configv1.ConfigureResponse, error) {
+func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest) (_ *configv1.ConfigureResponse, err error) {
 	if req.HclConfiguration == "" {
 		return nil, status.Error(codes.InvalidArgument, "configuration cannot be empty")
 	}
@@ -78,53 +248,268 @@ func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest)
 	if err != nil {
 		return nil, err
 	}
-	p.setConfig(config)
+
+	// Adaptors built before a failing step are closed rather than left with
+	// open connections and background refreshes.
+	var built adaptors
+	defer func() {
+		if err != nil {
+			p.closeAdaptors(built)
+		}
+	}()
+
+	userAuthService, err := newValidationChain(config, p.logger)
+	if err != nil {
+		return nil, err
+	}
+	built.userAuthService = userAuthService
+	if len(config.PolicyFiles) > 0 {
+		policyEngine, err := peAdptr.LoadCELPolicyEngine(config.PolicyFiles)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to load policies: %v", err)
+		}
+		built.policyEngine = policyEngine
+	}
+	if config.LDAP != nil {
+		userDirectory, err := newLDAPDirectory(config.LDAP)
+		if err != nil {
+			return nil, err
+		}
+		built.userDirectory = userDirectory
+	}
+
+	userAttestorModule, err := newModuleSet(config, p.logger)
+	if err != nil {
+		return nil, err
+	}
+	built.userAttestorModule = userAttestorModule
+	if err := userAttestorModule.negotiate(p.logger); err != nil {
+		return nil, err
+	}
+	var revocationList *rlAdptr.RevocationListAdaptor
+	if config.RevocationListFile != "" || config.RevocationListURL != "" {
+		if revocationList, err = p.newRevocationList(config); err != nil {
+			return nil, err
+		}
+		built.revocationList = revocationList
+	}
+	// The metrics server is started last, so no failing step leaves it serving
+	// a configuration that was not installed.
+	if err := p.serveMetrics(config.MetricsAddress); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to serve metrics on %q: %v", config.MetricsAddress, err)
+	}
+
+	// Attestations already running finish with the previous snapshot, whose
+	// connections are closed once they are done.
+	p.updateSnapshot(func(next *snapshot) {
+		next.config = config
+		next.adaptors = built
+	})
+	// Session events invalidate the caches of the installed snapshot, so the
+	// stream is only opened once the new adaptors are in place.
+	userAttestorModule.watchSessionEvents(p.logger, p.handleSessionEvent)
+	publishRevocationMetrics(revocationList)
+
+	if len(config.Validators) == 0 {
+		p.logger.Warn("No auth service endpoint or validator configured: attestations are not validated", "audit", true)
+	}
+	if config.Enforcement == enforcementShadow {
+		p.logger.Warn("Shadow enforcement enabled: attestations that fail checks are only audited and still get selectors", "audit", true)
+	}
+	if config.AllowDegradedValidation {
+		p.logger.Warn("Degraded validation enabled: recent successful validations are reused while the auth service is unavailable",
+			"audit", true,
+			"grace_period", config.authServiceGracePeriod,
+		)
+	}
 	return &configv1.ConfigureResponse{}, nil
 }
 
 func (p *Plugin) SetLogger(logger hclog.Logger) {
-	p.logger = logger
+	p.logger = newRedactingLogger(logger)
 }
 
 // ======| private |======
 
 func (p *Plugin) SetUserAttestorModule(userAttestorModule presentation.UserAttestorModule) {
-	p.userAttestorModule = userAttestorModule
+	p.updateSnapshot(func(next *snapshot) {
+		next.adaptors.userAttestorModule = userAttestorModule
+	})
 }
 
 func (p *Plugin) SetUserAuthService(userAuthService presentation.UserAuthService) {
-	p.userAuthService = userAuthService
+	p.updateSnapshot(func(next *snapshot) {
+		next.adaptors.userAuthService = userAuthService
+	})
+}
+
+func (p *Plugin) SetPolicyEngine(policyEngine presentation.PolicyEngine) {
+	p.updateSnapshot(func(next *snapshot) {
+		next.adaptors.policyEngine = policyEngine
+	})
 }
 
-func (p *Plugin) setConfig(config *Config) {
-	p.configMtx.Lock()
-	defer p.configMtx.Unlock()
-	p.config = config
+func (p *Plugin) SetUserDirectory(userDirectory presentation.UserDirectory) {
+	p.updateSnapshot(func(next *snapshot) {
+		next.adaptors.userDirectory = userDirectory
+	})
 }
 
-func (p *Plugin) getConfig() (*Config, error) {
-	p.configMtx.RLock()
-	defer p.configMtx.RUnlock()
-	if p.config == nil {
-		return nil, status.Error(codes.FailedPrecondition, "not configured")
+func (p *Plugin) applyPolicies(ctx context.Context, config *Config, policyEngine presentation.PolicyEngine, pid int32, attestationData *domain.UserAttestation, attestationResult domain.UserAttestationValidation, selectors []string) ([]string, error) {
+	processInfo, err := getProcessInfo(ctx, config.ProcRoot, pid)
+	if err != nil {
+		p.logger.Error("Failed to inspect the attested process", "pid", pid, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to inspect process %d: %v", pid, err)
+	}
+
+	decision, err := policyEngine.Evaluate(domain.PolicyInput{
+		Attestation: *attestationData,
+		Process:     processInfo,
+		Validation:  attestationResult,
+	})
+	if err != nil {
+		p.logger.Error("Failed to evaluate attestation policies", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to evaluate attestation policies: %v", err)
 	}
-	return p.config, nil
+	if !decision.Allowed {
+		p.logger.Warn("Attestation denied by policy",
+			"audit", true,
+			"rule", decision.DeniedBy,
+			"user", attestationData.UserInfo.Name,
+			"pid", pid,
+			"exe", processInfo.Exe,
+		)
+		return nil, status.Errorf(codes.PermissionDenied, "attestation denied by policy rule %q: %s", decision.DeniedBy, decision.Message)
+	}
+	return validSelectors(decision.ApplyTo(selectors)), nil
 }
 
-func (p *Plugin) buildSelectors(userInfo *domain.UserInfo) ([]string, error) {
-	selectors := []string{}
+func newValidationChain(config *Config, logger hclog.Logger) (presentation.UserAuthService, error) {
+	chain := &validationChain{}
+	for _, validatorConfig := range config.Validators {
+		var validator presentation.UserAuthService
+		switch validatorConfig.Name {
+		case validatorAuthService:
+			userAuthService, err := newUserAuthService(config, logger)
+			if err != nil {
+				chain.Close()
+				return nil, err
+			}
+			validator = userAuthService
+		case validatorLocalAccount:
+			validator = adAdptr.LocalAccountValidator{Database: adAdptr.AccountDatabase{EtcDir: config.EtcRoot}}
+		case validatorOIDC:
+			validator = ovAdptr.NewOIDCValidatorAdaptor(ovAdptr.OIDCValidatorOptions{
+				IssuerURL:         config.OIDC.Issuer,
+				Audience:          config.OIDC.Audience,
+				RequireNonce:      config.OIDC.RequireNonce,
+				UserClaim:         config.OIDC.UserClaim,
+				ClaimSelectors:    config.OIDC.ClaimSelectors,
+				DiscoveryCacheTTL: config.OIDC.discoveryCacheTTL,
+				HTTPClient:        &http.Client{Timeout: config.OIDC.timeout},
+			})
+		}
+		chain.steps = append(chain.steps, validationStep{
+			name:      validatorConfig.Name,
+			mode:      validationMode(validatorConfig.Mode),
+			validator: validator,
+		})
+	}
+	return chain, nil
+}
 
-	selectors = append(selectors, "name:"+userInfo.Name)
-	selectors = append(selectors, "secret:"+userInfo.Secret)
-	selectors = append(selectors, "system:user_id:"+userInfo.SystemInfo.UserID)
-	selectors = append(selectors, "system:username:"+userInfo.SystemInfo.Username)
-	selectors = append(selectors, "system:group_id:"+userInfo.SystemInfo.GroupID)
-	selectors = append(selectors, "system:groupName:"+userInfo.SystemInfo.GroupName)
+func newUserAuthService(config *Config, logger hclog.Logger) (presentation.UserAuthService, error) {
+	endpoints, err := uasAdptr.NewEndpointPool(config.authServiceEndpoints, uasAdptr.EndpointPoolOptions{
+		Strategy:            uasAdptr.LoadBalancingStrategy(config.AuthServiceLoadBalancing),
+		ConsecutiveFailures: config.AuthServiceOutlierFailures,
+		EjectionTime:        config.authServiceEjectionTime,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid auth service endpoints: %v", err)
+	}
 
+	adaptor := uasAdptr.UserAuthServiceAdaptor{
+		Endpoints:  endpoints,
+		HTTPClient: &http.Client{Timeout: config.authServiceTimeout},
+		OnExchange: authServiceExchangeLogger(config, logger),
+	}
+	return uasAdptr.NewCircuitBreakerAuthService(
+		adaptor,
+		uasAdptr.CircuitBreakerOptions{
+			FailureThreshold: config.AuthServiceFailureThreshold,
+			ResetTimeout:     config.authServiceResetTimeout,
+			AllowGrace:       config.AllowDegradedValidation,
+			GracePeriod:      config.authServiceGracePeriod,
+		},
+	), nil
+}
+
+func (p *Plugin) buildSelectors(userInfo *domain.UserInfo) ([]string, error) {
+	type field struct{ key, value string }
+	fields := []field{
+		{"name", userInfo.Name},
+		{"secret", userInfo.Secret},
+		{"system:user_id", userInfo.SystemInfo.UserID},
+		{"system:username", userInfo.SystemInfo.Username},
+		{"system:group_id", userInfo.SystemInfo.GroupID},
+		{"system:groupName", userInfo.SystemInfo.GroupName},
+	}
 	for _, group := range userInfo.SystemInfo.SupplementaryGroups {
-		selectors = append(selectors, "system:supplementary_group_id:"+group.GroupID)
-		selectors = append(selectors, "system:supplementary_group_name:"+group.GroupName)
+		fields = append(fields,
+			field{"system:supplementary_group_id", group.GroupID},
+			field{"system:supplementary_group_name", group.GroupName},
+			field{"system:inner_supplementary_group_id", group.InnerGroupID},
+		)
 	}
+	fields = append(fields,
+		field{"system:inner_user_id", userInfo.SystemInfo.InnerUserID},
+		field{"system:inner_group_id", userInfo.SystemInfo.InnerGroupID},
+	)
 
+	// Fields the module left empty get no selector, rather than one matching
+	// every user without that field.
+	selectors := []string{}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if !validSelectorValue(field.value) && sensitiveKey(field.key) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s", field.key)
+		}
+		if !validSelectorValue(field.value) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s %q", field.key, field.value)
+		}
+		selectors = append(selectors, field.key+":"+field.value)
+	}
 	return selectors, nil
 }
+
+// validSelectorValue rejects values that could not have come from a real
+// account and would be ambiguous in logs and registration entries.
+func validSelectorValue(value string) bool {
+	return utf8.ValidString(value) && !strings.ContainsFunc(value, unicode.IsControl)
+}
+
+// appendSelector adds key followed by values to selectors. Unlike the fields
+// of the module, which fail the attestation, a selector with an empty or
+// invalid value is left out.
+func appendSelector(selectors []string, key string, values ...string) []string {
+	for _, value := range values {
+		if value == "" || !validSelectorValue(value) {
+			return selectors
+		}
+	}
+	return append(selectors, strings.Join(append([]string{key}, values...), ":"))
+}
+
+// validSelectors keeps the selectors built elsewhere, by validators or
+// policies, that appendSelector would have added.
+func validSelectors(selectors []string) []string {
+	valid := []string{}
+	for _, selector := range selectors {
+		if !strings.HasSuffix(selector, ":") && validSelectorValue(selector) {
+			valid = append(valid, selector)
+		}
+	}
+	return valid
+}
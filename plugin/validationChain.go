@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+)
+
+type validationMode string
+
+const (
+	// A failing required step fails the chain, but the remaining steps still run.
+	validationModeRequired validationMode = "required"
+	// A failing requisite step fails the chain at once, the remaining steps
+	// do not run.
+	validationModeRequisite validationMode = "requisite"
+	// A succeeding sufficient step ends the chain successfully unless a required
+	// step already failed. Its failure is ignored.
+	validationModeSufficient validationMode = "sufficient"
+	// An optional step only decides the outcome when no required or sufficient
+	// step took part in the chain.
+	validationModeOptional validationMode = "optional"
+)
+
+type validationStep struct {
+	name      string
+	mode      validationMode
+	validator presentation.UserAuthService
+}
+
+// validationChain runs its steps in order with PAM-like semantics and combines
+// their results into a single validation.
+type validationChain struct {
+	presentation.UserAuthService
+	steps []validationStep
+}
+
+func (chain *validationChain) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
+	// A chain without validators accepts what the modules report.
+	if len(chain.steps) == 0 {
+		return domain.UserAttestationValidation{IsValid: true, Message: "no validator configured"}, nil
+	}
+	result := domain.UserAttestationValidation{}
+	requiredFailed := false
+	decisive := false
+	optionalSucceeded := false
+
+	for _, step := range chain.steps {
+		stepResult, err := step.validator.ValidateData(data)
+		if err != nil {
+			// Without an answer from a required step no decision can be made.
+			if step.mode == validationModeRequired || step.mode == validationModeRequisite {
+				return domain.UserAttestationValidation{}, fmt.Errorf("%s: %w", step.name, err)
+			}
+			stepResult = domain.UserAttestationValidation{Message: err.Error()}
+		}
+		result.Steps = append(result.Steps, domain.ValidationStep{
+			Name:    step.name,
+			Mode:    string(step.mode),
+			IsValid: stepResult.IsValid,
+			Message: stepResult.Message,
+		})
+		if stepResult.IsValid {
+			result.Degraded = result.Degraded || stepResult.Degraded
+			result.ExpiresAt = domain.EarlierExpiry(result.ExpiresAt, stepResult.ExpiresAt)
+			result.Selectors = append(result.Selectors, stepResult.Selectors...)
+		}
+
+		switch step.mode {
+		case validationModeRequired:
+			decisive = true
+			if !stepResult.IsValid {
+				requiredFailed = true
+			}
+		case validationModeRequisite:
+			decisive = true
+			if !stepResult.IsValid {
+				result.IsValid = false
+				result.Message = combineStepMessages(result.Steps)
+				return result, nil
+			}
+		case validationModeSufficient:
+			if stepResult.IsValid && !requiredFailed {
+				result.IsValid = true
+				result.Message = combineStepMessages(result.Steps)
+				return result, nil
+			}
+		case validationModeOptional:
+			if stepResult.IsValid {
+				optionalSucceeded = true
+			}
+		}
+	}
+
+	switch {
+	case requiredFailed:
+		result.IsValid = false
+	case decisive:
+		result.IsValid = true
+	default:
+		result.IsValid = optionalSucceeded
+	}
+	result.Message = combineStepMessages(result.Steps)
+	return result, nil
+}
+
+// Close closes the validators of the chain that hold connections.
+func (chain *validationChain) Close() error {
+	var errs []error
+	for _, step := range chain.steps {
+		if closer, ok := step.validator.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// InvalidateUser forwards the invalidation to the validators of the chain
+// that cache results.
+func (chain *validationChain) InvalidateUser(name string) {
+	for _, step := range chain.steps {
+		if cache, ok := step.validator.(presentation.UserCache); ok {
+			cache.InvalidateUser(name)
+		}
+	}
+}
+
+func combineStepMessages(steps []domain.ValidationStep) string {
+	messages := make([]string, len(steps))
+	for i, step := range steps {
+		outcome := "ok"
+		if !step.IsValid {
+			outcome = "failed"
+		}
+		messages[i] = fmt.Sprintf("%s (%s, %s): %s", step.Name, step.Mode, outcome, step.Message)
+	}
+	return strings.Join(messages, "; ")
+}
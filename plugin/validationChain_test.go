@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"wl/plugin/domain"
+	"wl/plugin/presentation"
+)
+
+// stepValidator answers with a fixed validation, or err when set, and
+// records that it ran.
+type stepValidator struct {
+	presentation.UserAuthService
+	valid     bool
+	err       error
+	expiresAt time.Time
+	selectors []string
+	message   string
+	ran       *[]string
+	name      string
+	closed    bool
+}
+
+func (validator *stepValidator) ValidateData(data *domain.UserAttestation) (domain.UserAttestationValidation, error) {
+	*validator.ran = append(*validator.ran, validator.name)
+	if validator.err != nil {
+		return domain.UserAttestationValidation{}, validator.err
+	}
+	return domain.UserAttestationValidation{
+		IsValid:   validator.valid,
+		Message:   validator.message,
+		ExpiresAt: validator.expiresAt,
+		Selectors: validator.selectors,
+	}, nil
+}
+
+func (validator *stepValidator) Close() error {
+	validator.closed = true
+	return nil
+}
+
+type stepSpec struct {
+	mode  validationMode
+	valid bool
+	err   error
+}
+
+func succeeding(mode validationMode) stepSpec { return stepSpec{mode: mode, valid: true} }
+func failing(mode validationMode) stepSpec    { return stepSpec{mode: mode} }
+
+func newTestChain(specs []stepSpec) (*validationChain, *[]string) {
+	ran := &[]string{}
+	chain := &validationChain{}
+	for i, spec := range specs {
+		name := string(rune('a' + i))
+		chain.steps = append(chain.steps, validationStep{
+			name: name,
+			mode: spec.mode,
+			validator: &stepValidator{
+				valid: spec.valid,
+				err:   spec.err,
+				ran:   ran,
+				name:  name,
+			},
+		})
+	}
+	return chain, ran
+}
+
+func TestValidationChainModes(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	for _, tc := range []struct {
+		name  string
+		steps []stepSpec
+		valid bool
+		err   bool
+		ran   []string
+	}{
+		{
+			name:  "required steps succeed",
+			steps: []stepSpec{succeeding(validationModeRequired), succeeding(validationModeRequired)},
+			valid: true,
+			ran:   []string{"a", "b"},
+		},
+		{
+			name:  "failed required still runs the remaining steps",
+			steps: []stepSpec{failing(validationModeRequired), succeeding(validationModeRequired)},
+			ran:   []string{"a", "b"},
+		},
+		{
+			name:  "required without an answer",
+			steps: []stepSpec{{mode: validationModeRequired, err: errUnavailable}, succeeding(validationModeRequired)},
+			err:   true,
+			ran:   []string{"a"},
+		},
+		{
+			name:  "failed requisite ends the chain",
+			steps: []stepSpec{failing(validationModeRequisite), succeeding(validationModeSufficient)},
+			ran:   []string{"a"},
+		},
+		{
+			name:  "requisite without an answer",
+			steps: []stepSpec{{mode: validationModeRequisite, err: errUnavailable}, succeeding(validationModeRequired)},
+			err:   true,
+			ran:   []string{"a"},
+		},
+		{
+			name:  "requisite then required",
+			steps: []stepSpec{succeeding(validationModeRequisite), succeeding(validationModeRequired)},
+			valid: true,
+			ran:   []string{"a", "b"},
+		},
+		{
+			name:  "sufficient ends the chain",
+			steps: []stepSpec{succeeding(validationModeSufficient), failing(validationModeRequired)},
+			valid: true,
+			ran:   []string{"a"},
+		},
+		{
+			name:  "sufficient after failed required",
+			steps: []stepSpec{failing(validationModeRequired), succeeding(validationModeSufficient), succeeding(validationModeRequired)},
+			ran:   []string{"a", "b", "c"},
+		},
+		{
+			name:  "sufficient after succeeded required",
+			steps: []stepSpec{succeeding(validationModeRequired), succeeding(validationModeSufficient), failing(validationModeRequired)},
+			valid: true,
+			ran:   []string{"a", "b"},
+		},
+		{
+			name:  "failed sufficient is ignored",
+			steps: []stepSpec{{mode: validationModeSufficient, err: errUnavailable}, failing(validationModeSufficient), succeeding(validationModeRequired)},
+			valid: true,
+			ran:   []string{"a", "b", "c"},
+		},
+		{
+			name:  "only failed sufficient steps",
+			steps: []stepSpec{failing(validationModeSufficient)},
+			ran:   []string{"a"},
+		},
+		{
+			name:  "optional does not override required",
+			steps: []stepSpec{succeeding(validationModeOptional), failing(validationModeRequired)},
+			ran:   []string{"a", "b"},
+		},
+		{
+			name:  "failed optional is ignored",
+			steps: []stepSpec{failing(validationModeOptional), succeeding(validationModeRequired)},
+			valid: true,
+			ran:   []string{"a", "b"},
+		},
+		{
+			name:  "optional-only chain with a success",
+			steps: []stepSpec{failing(validationModeOptional), {mode: validationModeOptional, err: errUnavailable}, succeeding(validationModeOptional)},
+			valid: true,
+			ran:   []string{"a", "b", "c"},
+		},
+		{
+			name:  "optional-only chain without a success",
+			steps: []stepSpec{failing(validationModeOptional), {mode: validationModeOptional, err: errUnavailable}},
+			ran:   []string{"a", "b"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chain, ran := newTestChain(tc.steps)
+			result, err := chain.ValidateData(&domain.UserAttestation{})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", result)
+				}
+			} else if err != nil {
+				t.Fatalf("ValidateData failed: %v", err)
+			}
+			if result.IsValid != tc.valid {
+				t.Errorf("expected valid %t, got %+v", tc.valid, result)
+			}
+			if !slices.Equal(*ran, tc.ran) {
+				t.Errorf("expected steps %v to run, got %v", tc.ran, *ran)
+			}
+			if !tc.err && len(result.Steps) != len(tc.ran) {
+				t.Errorf("expected a result for each step run, got %+v", result.Steps)
+			}
+		})
+	}
+}
+
+func TestValidationChainCombinesResults(t *testing.T) {
+	soon := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ran := &[]string{}
+	chain := &validationChain{steps: []validationStep{
+		{name: "local_account", mode: validationModeRequired, validator: &stepValidator{name: "local_account", message: "account ok", valid: true, selectors: []string{"a:1"}, ran: ran}},
+		{name: "oidc", mode: validationModeOptional, validator: &stepValidator{name: "oidc", message: "bad token", selectors: []string{"b:1"}, ran: ran}},
+		{name: "auth_service", mode: validationModeRequired, validator: &stepValidator{name: "auth_service", message: "token ok", valid: true, expiresAt: soon, selectors: []string{"c:1"}, ran: ran}},
+	}}
+
+	result, err := chain.ValidateData(&domain.UserAttestation{})
+	if err != nil {
+		t.Fatalf("ValidateData failed: %v", err)
+	}
+	if !slices.Equal(result.Selectors, []string{"a:1", "c:1"}) {
+		t.Errorf("expected the selectors of the succeeding steps, got %v", result.Selectors)
+	}
+	if !result.ExpiresAt.Equal(soon) {
+		t.Errorf("expected the step expiry, got %s", result.ExpiresAt)
+	}
+	expected := "local_account (required, ok): account ok; oidc (optional, failed): bad token; auth_service (required, ok): token ok"
+	if result.Message != expected {
+		t.Errorf("unexpected message %q", result.Message)
+	}
+}
+
+func TestEmptyValidationChainAccepts(t *testing.T) {
+	chain, _ := newTestChain(nil)
+	result, err := chain.ValidateData(newAliceAttestation())
+	if err != nil {
+		t.Fatalf("ValidateData failed: %v", err)
+	}
+	if !result.IsValid || len(result.Steps) > 0 {
+		t.Errorf("expected a valid result without steps, got %+v", result)
+	}
+}
+
+func TestValidationChainClose(t *testing.T) {
+	chain, _ := newTestChain([]stepSpec{succeeding(validationModeRequired), succeeding(validationModeOptional)})
+	if err := chain.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, step := range chain.steps {
+		if !step.validator.(*stepValidator).closed {
+			t.Errorf("expected step %s to be closed", step.name)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	peAdptr "wl/plugin/infrastructure/policyEngine"
+)
+
+// runPolicyTests compiles the given policy files and runs the JSON test files
+// against them:
+//
+//	user_wl_attestor policy-test -policy a.hcl -policy b.hcl a_test.json
+func runPolicyTests(args []string) int {
+	flags := flag.NewFlagSet("policy-test", flag.ContinueOnError)
+	var policyFiles stringList
+	flags.Var(&policyFiles, "policy", "policy file to load, can be repeated")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(policyFiles) == 0 || flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: policy-test -policy <file> [-policy <file>...] <test file>...")
+		return 2
+	}
+
+	engine, err := peAdptr.LoadCELPolicyEngine(policyFiles)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	for _, testFile := range flags.Args() {
+		results, err := peAdptr.RunPolicyTests(engine, testFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, result := range results {
+			if result.Passed {
+				fmt.Printf("PASS %s: %s\n", testFile, result.Name)
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %s: %s: %s\n", testFile, result.Name, result.Failure)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d policy test(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}